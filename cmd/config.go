@@ -0,0 +1,248 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/karldahlgren/raccoon/config"
+	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/karldahlgren/raccoon/utility"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"math/rand"
+	"os"
+	"strconv"
+)
+
+// clusterContext is the selected cluster context, or nil if no context has been selected
+var clusterContext *config.Context
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage named cluster contexts",
+	Long: `The config command manages the named cluster contexts in the configuration file. A context contains
+			the bootstrap server, security settings and defaults for a Kafka cluster, and is selected with the 
+			context flag or by setting it as the current context.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// The config commands operate on the configuration file itself and don't use a context
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all cluster contexts",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, configuration := loadConfiguration()
+		if len(configuration.Contexts) == 0 {
+			fmt.Println("No contexts found in " + path)
+			return
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Current", "Name", "Bootstrap server", "Security protocol", "Group prefix", "Limit"})
+		for _, context := range configuration.Contexts {
+			current := ""
+			if context.Name == configuration.CurrentContext {
+				current = "*"
+			}
+
+			limit := ""
+			if context.Limit > 0 {
+				limit = strconv.FormatInt(context.Limit, 10)
+			}
+
+			table.Append([]string{current, context.Name, context.BootstrapServer, context.SecurityProtocol,
+				context.GroupPrefix, limit})
+		}
+		table.Render()
+	},
+}
+
+var configAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a new cluster context",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		groupPrefix := getStringFlag(cmd, "group-prefix")
+		limit := getInt64Flag(cmd, "limit")
+		use := getBoolFlag(cmd, "use")
+
+		if limit < 0 {
+			fmt.Printf("Limit cannot be less than zero")
+			return
+		}
+
+		connection, err := getConnection(cmd)
+		if err != nil {
+			fmt.Printf("Invalid connection settings: %v", err)
+			return
+		}
+
+		path, configuration := loadConfiguration()
+		context := &config.Context{
+			Name:                   args[0],
+			BootstrapServer:        connection.BootstrapServer,
+			SecurityProtocol:       connection.SecurityProtocol,
+			SaslMechanism:          connection.SaslMechanism,
+			SaslUsername:           connection.SaslUsername,
+			SaslPassword:           connection.SaslPassword,
+			OAuthBearerToken:       connection.OAuthBearerToken,
+			SslCALocation:          connection.SslCALocation,
+			SslCertificateLocation: connection.SslCertificateLocation,
+			SslKeyLocation:         connection.SslKeyLocation,
+			SslKeyPassword:         connection.SslKeyPassword,
+			SslVerifyHostname:      connection.SslVerifyHostname,
+			Properties:             connection.Properties,
+			SchemaRegistry:         getStringFlag(cmd, "schema-registry"),
+			GroupPrefix:            groupPrefix,
+			Limit:                  limit,
+		}
+
+		if err := configuration.AddContext(context); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if use {
+			_ = configuration.UseContext(context.Name)
+		}
+
+		utility.ExitOnError(configuration.Save(path))
+		fmt.Println("Added context " + context.Name + " to " + path)
+	},
+}
+
+var configRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a cluster context",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, configuration := loadConfiguration()
+		if err := configuration.RemoveContext(args[0]); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		utility.ExitOnError(configuration.Save(path))
+		fmt.Println("Removed context " + args[0])
+	},
+}
+
+var configUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Set the current cluster context",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, configuration := loadConfiguration()
+		if err := configuration.UseContext(args[0]); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		utility.ExitOnError(configuration.Save(path))
+		fmt.Println("Switched to context " + args[0])
+	},
+}
+
+func init() {
+	addConnectionFlags(configAddCmd)
+	configAddCmd.Flags().String("group-prefix", "", "Prefix for generated consumer group names (Optional)")
+	configAddCmd.Flags().Int64P("limit", "l", 0, "Default grep limit per partition (Optional)")
+	configAddCmd.Flags().Bool("use", false, "Set the new context as the current context (Optional)")
+
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configAddCmd)
+	configCmd.AddCommand(configRemoveCmd)
+	configCmd.AddCommand(configUseCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// loadContext loads the configuration file and selects the context from the context flag or the current context
+func loadContext(cmd *cobra.Command) {
+	_, configuration := loadConfiguration()
+
+	context, err := configuration.SelectContext(getStringFlag(cmd, "context"))
+	utility.ExitOnError(err)
+	clusterContext = context
+}
+
+func loadConfiguration() (string, *config.Configuration) {
+	path, err := config.ConfigurationPath()
+	utility.ExitOnError(err)
+
+	configuration, err := config.LoadConfiguration(path)
+	utility.ExitOnError(err)
+	return path, configuration
+}
+
+// getContextConnection creates the connection settings from the selected context
+func getContextConnection() (kafka.Connection, error) {
+	connection := kafka.Connection{}
+	if clusterContext == nil {
+		return connection, nil
+	}
+
+	connection.BootstrapServer = clusterContext.BootstrapServer
+	connection.SecurityProtocol = clusterContext.SecurityProtocol
+	connection.SaslMechanism = clusterContext.SaslMechanism
+	connection.SaslUsername = clusterContext.SaslUsername
+	connection.SaslPassword = clusterContext.SaslPassword
+	connection.OAuthBearerToken = clusterContext.OAuthBearerToken
+	connection.SslCALocation = clusterContext.SslCALocation
+	connection.SslCertificateLocation = clusterContext.SslCertificateLocation
+	connection.SslKeyLocation = clusterContext.SslKeyLocation
+	connection.SslKeyPassword = clusterContext.SslKeyPassword
+	connection.SslVerifyHostname = clusterContext.SslVerifyHostname
+
+	for key, value := range clusterContext.Properties {
+		if err := connection.SetProperty(key, value); err != nil {
+			return connection, fmt.Errorf("context %s: %v", clusterContext.Name, err)
+		}
+	}
+
+	return connection, nil
+}
+
+// getGroup returns the group flag. A group name is generated from the group prefix
+// of the selected context if no group has been provided
+func getGroup(cmd *cobra.Command) string {
+	group := getStringFlag(cmd, "group")
+	if group == "" && clusterContext != nil && clusterContext.GroupPrefix != "" {
+		group = clusterContext.GroupPrefix + "-" + strconv.Itoa(rand.Int())
+	}
+
+	return group
+}
+
+// getLimit returns the limit flag, or the default limit of the selected context if the flag hasn't been set
+func getLimit(cmd *cobra.Command) int64 {
+	limit := getInt64Flag(cmd, "limit")
+	if !cmd.Flags().Changed("limit") && clusterContext != nil && clusterContext.Limit > 0 {
+		limit = clusterContext.Limit
+	}
+
+	return limit
+}
@@ -0,0 +1,119 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/karldahlgren/raccoon/utility"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var connectionFlags = map[string]string{
+	"security-protocol":        "security.protocol",
+	"sasl-mechanism":           "sasl.mechanism",
+	"sasl-username":            "sasl.username",
+	"sasl-password":            "sasl.password",
+	"ssl-ca-location":          "ssl.ca.location",
+	"ssl-certificate-location": "ssl.certificate.location",
+	"ssl-key-location":         "ssl.key.location",
+	"ssl-key-password":         "ssl.key.password",
+}
+
+func addConnectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("bootstrap-server", "b", "", "Bootstrap server address (Required)")
+	cmd.Flags().String("consumer-config", "", "Properties file with librdkafka client properties (Optional)")
+	cmd.Flags().StringArrayP("property", "X", []string{}, "librdkafka client property as key=value. Can be repeated (Optional)")
+	cmd.Flags().String("security-protocol", "", "Security protocol: PLAINTEXT, SSL, SASL_PLAINTEXT or SASL_SSL (Optional)")
+	cmd.Flags().String("sasl-mechanism", "", "SASL mechanism: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512 or OAUTHBEARER (Optional)")
+	cmd.Flags().String("sasl-username", "", "SASL username (Optional)")
+	cmd.Flags().String("sasl-password", "", "SASL password (Optional)")
+	cmd.Flags().String("sasl-oauthbearer-token", "", "OAuth bearer token for the OAUTHBEARER mechanism (Optional)")
+	cmd.Flags().String("ssl-ca-location", "", "CA certificate file for verifying the broker certificate (Optional)")
+	cmd.Flags().String("ssl-certificate-location", "", "Client certificate file (Optional)")
+	cmd.Flags().String("ssl-key-location", "", "Client private key file (Optional)")
+	cmd.Flags().String("ssl-key-password", "", "Client private key password (Optional)")
+	cmd.Flags().Bool("ssl-verify-hostname", true, "Verify the broker hostname against its certificate (Optional)")
+	cmd.Flags().String("schema-registry", "", "Schema registry URL (Optional)")
+}
+
+// getConnection creates the connection settings from the selected context, the client config file, the property
+// flags and the connection flags, in that order. Flags that have been set explicitly override the values in the file
+func getConnection(cmd *cobra.Command) (kafka.Connection, error) {
+	connection, err := getContextConnection()
+	if err != nil {
+		return connection, err
+	}
+
+	consumerConfig := getStringFlag(cmd, "consumer-config")
+	if consumerConfig != "" {
+		properties, err := utility.ReadProperties(consumerConfig)
+		if err != nil {
+			return connection, err
+		}
+
+		for key, value := range properties {
+			if err := connection.SetProperty(key, value); err != nil {
+				return connection, fmt.Errorf("%s: %v", consumerConfig, err)
+			}
+		}
+	}
+
+	for _, property := range getStringArrayFlag(cmd, "property") {
+		separator := strings.Index(property, "=")
+		if separator == -1 {
+			return connection, fmt.Errorf("invalid property %q. Expected key=value", property)
+		}
+
+		if err := connection.SetProperty(property[:separator], property[separator+1:]); err != nil {
+			return connection, err
+		}
+	}
+
+	for name, property := range connectionFlags {
+		if cmd.Flags().Changed(name) {
+			_ = connection.SetProperty(property, getStringFlag(cmd, name))
+		}
+	}
+
+	if cmd.Flags().Changed("bootstrap-server") {
+		connection.BootstrapServer = getStringFlag(cmd, "bootstrap-server")
+	}
+
+	if cmd.Flags().Changed("sasl-oauthbearer-token") {
+		connection.OAuthBearerToken = getStringFlag(cmd, "sasl-oauthbearer-token")
+	}
+
+	if cmd.Flags().Changed("ssl-verify-hostname") {
+		if getBoolFlag(cmd, "ssl-verify-hostname") {
+			connection.SslVerifyHostname = "https"
+		} else {
+			connection.SslVerifyHostname = "none"
+		}
+	}
+
+	return connection, connection.Validate()
+}
@@ -0,0 +1,99 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+package cmd
+
+import (
+	"github.com/karldahlgren/raccoon/config"
+	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/spf13/cobra"
+	"reflect"
+	"testing"
+)
+
+// testConnection creates the connection settings of a command with the connection flags, the context and the arguments
+func testConnection(t *testing.T, context *config.Context, args ...string) (kafka.Connection, error) {
+	selectedContext := clusterContext
+	clusterContext = context
+	defer func() {
+		clusterContext = selectedContext
+	}()
+
+	cmd := &cobra.Command{}
+	addConnectionFlags(cmd)
+	if err := cmd.Flags().Parse(args); err != nil {
+		t.Fatalf("unable to parse %v: %v", args, err)
+	}
+
+	return getConnection(cmd)
+}
+
+func TestGetConnectionMergesTheContextAndTheFlags(t *testing.T) {
+	context := &config.Context{
+		Name:             "prod",
+		BootstrapServer:  "broker:9093",
+		SecurityProtocol: "SASL_SSL",
+		SaslMechanism:    "OAUTHBEARER",
+		OAuthBearerToken: "context-token",
+		SslCALocation:    "ca.pem",
+		Properties:       map[string]string{"client.id": "raccoon", "fetch.max.bytes": "1024"},
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected kafka.Connection
+	}{
+		{
+			name: "context only",
+			expected: kafka.Connection{BootstrapServer: "broker:9093", SecurityProtocol: "SASL_SSL",
+				SaslMechanism: "OAUTHBEARER", OAuthBearerToken: "context-token", SslCALocation: "ca.pem",
+				Properties: map[string]string{"client.id": "raccoon", "fetch.max.bytes": "1024"}},
+		},
+		{
+			name: "flags override the context",
+			args: []string{"-b", "other:9093", "--sasl-oauthbearer-token", "flag-token", "--ssl-ca-location", "other.pem",
+				"-X", "client.id=test", "--ssl-verify-hostname=false"},
+			expected: kafka.Connection{BootstrapServer: "other:9093", SecurityProtocol: "SASL_SSL",
+				SaslMechanism: "OAUTHBEARER", OAuthBearerToken: "flag-token", SslCALocation: "other.pem",
+				SslVerifyHostname: "none", Properties: map[string]string{"client.id": "test", "fetch.max.bytes": "1024"}},
+		},
+	}
+
+	for _, test := range tests {
+		connection, err := testConnection(t, context, test.args...)
+		if err != nil {
+			t.Errorf("%s: unable to create connection: %v", test.name, err)
+		} else if !reflect.DeepEqual(connection, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, connection)
+		}
+	}
+}
+
+func TestGetConnectionRequiresATokenForOAuthBearer(t *testing.T) {
+	_, err := testConnection(t, nil, "-b", "broker:9093", "--security-protocol", "SASL_SSL",
+		"--sasl-mechanism", "OAUTHBEARER")
+	if err == nil {
+		t.Errorf("expected OAUTHBEARER without a token to be rejected")
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var serializationFormats = []string{"string", "avro", "protobuf"}
+
+func addDecoderFlags(cmd *cobra.Command) {
+	cmd.Flags().String("key-format", "string", "Key format: string, avro or protobuf (Optional)")
+	cmd.Flags().String("value-format", "string", "Value format: string, avro or protobuf (Optional)")
+	cmd.Flags().String("proto-descriptor", "", "Protobuf descriptor set file for the protobuf format (Optional)")
+	cmd.Flags().String("proto-message", "", "Fully qualified protobuf message type of the value, e.g. com.example.Order (Optional)")
+	cmd.Flags().String("proto-key-message", "", "Fully qualified protobuf message type of the key (Optional)")
+}
+
+// getSchemaRegistry returns the schema registry flag, or the schema registry of the selected context
+func getSchemaRegistry(cmd *cobra.Command) string {
+	registry := getStringFlag(cmd, "schema-registry")
+	if !cmd.Flags().Changed("schema-registry") && clusterContext != nil {
+		registry = clusterContext.SchemaRegistry
+	}
+
+	return registry
+}
+
+// getDecoders creates the key and value decoders from the format flags. The decoders share
+// a single schema registry client, so each schema is only retrieved once
+func getDecoders(cmd *cobra.Command) (kafka.Decoders, error) {
+	var registry *kafka.SchemaRegistry
+	createDecoder := func(name string, messageFlag string) (kafka.Decoder, error) {
+		format := strings.ToLower(getStringFlag(cmd, name))
+		switch format {
+		case "string":
+			return nil, nil
+		case "avro":
+			if registry == nil {
+				url := getSchemaRegistry(cmd)
+				if url == "" {
+					return nil, fmt.Errorf("the avro format requires a schema registry")
+				}
+				registry = kafka.CreateSchemaRegistry(url)
+			}
+			return kafka.CreateAvroDecoder(registry), nil
+		case "protobuf":
+			descriptor := getStringFlag(cmd, "proto-descriptor")
+			message := getStringFlag(cmd, messageFlag)
+			if descriptor == "" || message == "" {
+				return nil, fmt.Errorf("the protobuf %s requires a descriptor set and a message type", name)
+			}
+			return kafka.CreateProtobufDecoder(descriptor, message)
+		default:
+			return nil, fmt.Errorf("unsupported %s %q. Expected one of %s", name, format,
+				strings.Join(serializationFormats, ", "))
+		}
+	}
+
+	keyDecoder, err := createDecoder("key-format", "proto-key-message")
+	if err != nil {
+		return kafka.Decoders{}, err
+	}
+
+	valueDecoder, err := createDecoder("value-format", "proto-message")
+	if err != nil {
+		return kafka.Decoders{}, err
+	}
+
+	return kafka.Decoders{Key: keyDecoder, Value: valueDecoder}, nil
+}
@@ -27,6 +27,7 @@ package cmd
 import (
 	"github.com/karldahlgren/raccoon/utility"
 	"github.com/spf13/cobra"
+	"time"
 )
 
 func getStringFlag(cmd *cobra.Command, name string) string  {
@@ -58,3 +59,43 @@ func getBoolFlag(cmd *cobra.Command, name string) bool  {
 
 	return value
 }
+
+func getStringArrayFlag(cmd *cobra.Command, name string) []string  {
+	value, err := cmd.Flags().GetStringArray(name)
+
+	if err != nil {
+		utility.ExitOnError(err)
+	}
+
+	return value
+}
+
+func getInt32SliceFlag(cmd *cobra.Command, name string) []int32  {
+	value, err := cmd.Flags().GetInt32Slice(name)
+
+	if err != nil {
+		utility.ExitOnError(err)
+	}
+
+	return value
+}
+
+func getDurationFlag(cmd *cobra.Command, name string) time.Duration  {
+	value, err := cmd.Flags().GetDuration(name)
+
+	if err != nil {
+		utility.ExitOnError(err)
+	}
+
+	return value
+}
+
+func getInt32Flag(cmd *cobra.Command, name string) int32  {
+	value, err := cmd.Flags().GetInt32(name)
+
+	if err != nil {
+		utility.ExitOnError(err)
+	}
+
+	return value
+}
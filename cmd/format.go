@@ -0,0 +1,279 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var formats = []string{"csv", "json", "ndjson", "text"}
+
+// messageWriter writes matched messages in a particular export format
+type messageWriter interface {
+	write(message *kafka.Message) error
+	flush() error
+	close() error
+}
+
+type csvMessageWriter struct {
+	writer *csv.Writer
+}
+
+type jsonMessageWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+type ndjsonMessageWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+type textMessageWriter struct {
+	writer *bufio.Writer
+}
+
+// exportedMessage is the JSON representation of a message. Values that are JSON objects or arrays
+// are embedded as JSON, while other values are exported as strings. Embedded values are compacted when
+// they are exported, so the original value is exported as a raw value as well unless it's unchanged
+type exportedMessage struct {
+	Topic     string           `json:"topic"`
+	Partition int32            `json:"partition"`
+	Offset    int64            `json:"offset"`
+	Timestamp time.Time        `json:"timestamp"`
+	Key       string           `json:"key"`
+	Value     json.RawMessage  `json:"value"`
+	RawValue  string           `json:"raw_value,omitempty"`
+	Headers   []exportedHeader `json:"headers,omitempty"`
+}
+
+// exportedHeader is the JSON representation of a header. Headers are exported as a list, since
+// a message can have several headers with the same name
+type exportedHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// getFormat returns the format flag, or infers the format from the extension of the output file
+func getFormat(format string, output string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(output)) {
+		case ".json":
+			return "json", nil
+		case ".ndjson", ".jsonl":
+			return "ndjson", nil
+		default:
+			return "csv", nil
+		}
+	}
+
+	format = strings.ToLower(format)
+	for _, supported := range formats {
+		if format == supported {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported format %q. Expected one of %s", format, strings.Join(formats, ", "))
+}
+
+func createMessageWriter(format string, writer io.Writer) (messageWriter, error) {
+	switch format {
+	case "json":
+		buffer := bufio.NewWriter(writer)
+		return &jsonMessageWriter{writer: buffer, encoder: json.NewEncoder(buffer)}, nil
+	case "ndjson":
+		buffer := bufio.NewWriter(writer)
+		return &ndjsonMessageWriter{writer: buffer, encoder: json.NewEncoder(buffer)}, nil
+	case "text":
+		return &textMessageWriter{writer: bufio.NewWriter(writer)}, nil
+	default:
+		csvWriter := csv.NewWriter(writer)
+		err := csvWriter.Write([]string{"topic", "partition", "offset", "timestamp", "key", "value", "headers"})
+		return &csvMessageWriter{writer: csvWriter}, err
+	}
+}
+
+func (writer *csvMessageWriter) write(message *kafka.Message) error {
+	return writer.writer.Write(getData(message))
+}
+
+func (writer *csvMessageWriter) flush() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+func (writer *csvMessageWriter) close() error {
+	return writer.flush()
+}
+
+func (writer *jsonMessageWriter) write(message *kafka.Message) error {
+	separator := ",\n"
+	if writer.count == 0 {
+		separator = "[\n"
+	}
+	writer.count++
+
+	if _, err := writer.writer.WriteString(separator); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(exportMessage(message))
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.writer.Write(data)
+	return err
+}
+
+func (writer *jsonMessageWriter) flush() error {
+	return writer.writer.Flush()
+}
+
+func (writer *jsonMessageWriter) close() error {
+	ending := "\n]\n"
+	if writer.count == 0 {
+		ending = "[]\n"
+	}
+
+	if _, err := writer.writer.WriteString(ending); err != nil {
+		return err
+	}
+
+	return writer.writer.Flush()
+}
+
+func (writer *ndjsonMessageWriter) write(message *kafka.Message) error {
+	return writer.encoder.Encode(exportMessage(message))
+}
+
+func (writer *ndjsonMessageWriter) flush() error {
+	return writer.writer.Flush()
+}
+
+func (writer *ndjsonMessageWriter) close() error {
+	return writer.flush()
+}
+
+func (writer *textMessageWriter) write(message *kafka.Message) error {
+	_, err := fmt.Fprintf(writer.writer, "%s topic=%s partition=%d offset=%d key=%s value=%s",
+		message.Timestamp.Format(time.RFC3339Nano), message.Topic, message.Partition, message.Offset, message.Key, message.Value)
+	if err != nil {
+		return err
+	}
+
+	if len(message.Headers) > 0 {
+		if _, err := fmt.Fprintf(writer.writer, " headers=%s", formatHeaders(message)); err != nil {
+			return err
+		}
+	}
+
+	_, err = writer.writer.WriteString("\n")
+	return err
+}
+
+func (writer *textMessageWriter) flush() error {
+	return writer.writer.Flush()
+}
+
+func (writer *textMessageWriter) close() error {
+	return writer.flush()
+}
+
+func exportMessage(message *kafka.Message) exportedMessage {
+	var value json.RawMessage
+	value, _ = json.Marshal(message.Value)
+	rawValue := ""
+	if isJSONDocument(message.Value) {
+		value = json.RawMessage(message.Value)
+		if exported, err := json.Marshal(value); err != nil || string(exported) != message.Value {
+			// Whitespace is removed and HTML characters are escaped by the export
+			rawValue = message.Value
+		}
+	}
+
+	return exportedMessage{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Timestamp: message.Timestamp,
+		Key:       message.Key,
+		Value:     value,
+		RawValue:  rawValue,
+		Headers:   getHeaders(message),
+	}
+}
+
+// isJSONDocument returns true if a value is a valid JSON object or array
+func isJSONDocument(value string) bool {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return false
+	}
+
+	return json.Valid([]byte(value))
+}
+
+func getHeaders(message *kafka.Message) []exportedHeader {
+	var headers []exportedHeader
+	for _, header := range message.Headers {
+		headers = append(headers, exportedHeader{Key: header.Key, Value: header.Value})
+	}
+
+	return headers
+}
+
+// formatHeaders formats the headers of a message as a JSON array, or an empty string if there are no headers
+func formatHeaders(message *kafka.Message) string {
+	headers := getHeaders(message)
+	if headers == nil {
+		return ""
+	}
+
+	data, _ := json.Marshal(headers)
+	return string(data)
+}
+
+func getData(message *kafka.Message) []string {
+	return []string{
+		message.Topic,
+		strconv.FormatInt(int64(message.Partition), 10),
+		strconv.FormatInt(message.Offset, 10),
+		message.Timestamp.String(),
+		message.Key,
+		message.Value,
+		formatHeaders(message)}
+}
@@ -0,0 +1,125 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/karldahlgren/raccoon/kafka"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportedMessagesAreImportedUnchanged(t *testing.T) {
+	timestamp := time.Date(2021, 1, 1, 14, 0, 0, 500, time.UTC)
+	values := []string{"42", `"42"`, "plain text", "", "null", `{"amount":1200}`, `{ "amount": 1200 }`, `[1,2,3]`,
+		`{"html":"<b>&</b>"}`, "{\n  \"amount\": 1200\n}\n", "line\nbreak"}
+	headers := []kafka.Header{{Key: "type", Value: "b"}, {Key: "trace", Value: "1"}, {Key: "type", Value: "a"}}
+
+	var messages []*kafka.Message
+	for index, value := range values {
+		messages = append(messages, &kafka.Message{Topic: "orders", Partition: int32(index), Offset: int64(index),
+			Timestamp: timestamp, Key: "key", Value: value, Headers: headers})
+	}
+	messages = append(messages, &kafka.Message{Topic: "orders", Partition: 0, Timestamp: timestamp, Key: "42",
+		Value: "no headers"})
+
+	for _, format := range []string{"csv", "json", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			var buffer bytes.Buffer
+			writer, err := createMessageWriter(format, &buffer)
+			if err != nil {
+				t.Fatalf("unable to create writer: %v", err)
+			}
+			for _, message := range messages {
+				if err := writer.write(message); err != nil {
+					t.Fatalf("unable to write message: %v", err)
+				}
+			}
+			if err := writer.close(); err != nil {
+				t.Fatalf("unable to close writer: %v", err)
+			}
+
+			reader, err := createMessageReader(format, &buffer)
+			if err != nil {
+				t.Fatalf("unable to create reader: %v", err)
+			}
+			for _, expected := range messages {
+				imported, err := reader.read()
+				if err != nil {
+					t.Fatalf("unable to read message: %v", err)
+				}
+
+				if imported.Topic != expected.Topic || imported.Partition != expected.Partition ||
+					!imported.Timestamp.Equal(expected.Timestamp) || imported.Key != expected.Key ||
+					imported.Value != expected.Value || !reflect.DeepEqual(imported.Headers, expected.Headers) {
+					t.Errorf("expected %+v, got %+v", expected, imported)
+				}
+			}
+			if _, err := reader.read(); err != io.EOF {
+				t.Errorf("expected the end of the input, got %v", err)
+			}
+		})
+	}
+}
+
+func TestObjectsAndArraysAreEmbedded(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		raw      string
+	}{
+		{value: "42", expected: `"42"`},
+		{value: `"42"`, expected: `"\"42\""`},
+		{value: "true", expected: `"true"`},
+		{value: `{"amount":1200}`, expected: `{"amount":1200}`},
+		{value: `[1,2]`, expected: `[1,2]`},
+		{value: `{"amount": 1200}`, expected: `{"amount":1200}`, raw: `{"amount": 1200}`},
+		{value: "{\n  \"amount\": 1200\n}\n", expected: `{"amount":1200}`, raw: "{\n  \"amount\": 1200\n}\n"},
+		{value: `{"html":"<b>"}`, expected: `{"html":"\u003cb\u003e"}`, raw: `{"html":"<b>"}`},
+		{value: `{"amount":`, expected: `"{\"amount\":"`},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(exportMessage(&kafka.Message{Value: test.value}))
+		if err != nil {
+			t.Fatalf("unable to export %q: %v", test.value, err)
+		}
+
+		var exported struct {
+			Value    json.RawMessage `json:"value"`
+			RawValue string          `json:"raw_value"`
+		}
+		if err := json.Unmarshal(data, &exported); err != nil {
+			t.Fatalf("invalid export of %q: %v", test.value, err)
+		}
+
+		if string(exported.Value) != test.expected || exported.RawValue != test.raw {
+			t.Errorf("expected %q to be exported as %s with raw value %q, got %s and %q", test.value, test.expected,
+				test.raw, exported.Value, exported.RawValue)
+		}
+	}
+}
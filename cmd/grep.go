@@ -27,7 +27,10 @@ package cmd
 import (
 	"fmt"
 	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/karldahlgren/raccoon/raccoon"
+	"github.com/karldahlgren/raccoon/utility"
 	"github.com/spf13/cobra"
+	"time"
 )
 
 var grepCmd = &cobra.Command{
@@ -35,21 +38,46 @@ var grepCmd = &cobra.Command{
 	Short: "Search through a Kafka topics and grep all matching messages",
 	Long:  `The tail command will subscribe to a topic with the earliest offset and read the 
 			specified amount of messages, or to the end of the topic, from each partition. 
-			All matched messages can be displayed in the terminal and/or exported to a CSV file.`,
+			All matched messages can be displayed in the terminal and/or exported to a CSV, JSON or NDJSON file.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		bootstrap := getStringFlag(cmd,"bootstrap-server")
-		group := getStringFlag(cmd,"group")
-		topic := getStringFlag(cmd,"topic")
+		group := getGroup(cmd)
+		topics := getStringArrayFlag(cmd, "topic")
+		topicPattern := getStringFlag(cmd, "topic-pattern")
 		keyQuery := getStringFlag(cmd,"key-query")
 		valueQuery := getStringFlag(cmd,"value-query")
+		headerQueries := getStringArrayFlag(cmd, "header-query")
+		regex := getBoolFlag(cmd, "regex")
+		where := getStringArrayFlag(cmd, "where")
+		filter := getStringFlag(cmd, "filter")
 		output := getStringFlag(cmd,"output")
+		format := getStringFlag(cmd, "format")
+		stream := getBoolFlag(cmd, "stream")
 		seekTimestamp := getStringFlag(cmd,"seek")
-		limit := getInt64Flag(cmd, "limit")
+		from := getStringFlag(cmd, "from")
+		to := getStringFlag(cmd, "to")
+		limit := getLimit(cmd)
 		verbose := getBoolFlag(cmd, "verbose")
+		spillThreshold := getInt64Flag(cmd, "spill-threshold")
+		maxMatches := getInt64Flag(cmd, "max-matches")
 		earliest := getBoolFlag(cmd, "earliest")
 		latest := getBoolFlag(cmd, "latest")
+		partitionIds := getInt32SliceFlag(cmd, "partition")
+		offsets := getStringArrayFlag(cmd, "offset")
+		workers := int(getInt64Flag(cmd, "workers"))
+		idleTimeout := getDurationFlag(cmd, "idle-timeout")
 
-		if earliest == true && latest == true {
+		if seekTimestamp != "" && from != "" {
+			fmt.Printf("Not allowed to combine seek timestamp flag with from flag")
+			return
+		} else if from != "" {
+			// The from flag is an alias for the seek timestamp flag
+			seekTimestamp = from
+		}
+
+		if len(topics) == 0 && topicPattern == "" {
+			fmt.Printf("A topic or a topic pattern is required")
+			return
+		} else if earliest == true && latest == true {
 			fmt.Printf("Not allowed to combine earliest flag with latest flag")
 			return
 		} else if seekTimestamp != "" && earliest == true {
@@ -61,35 +89,167 @@ var grepCmd = &cobra.Command{
 		} else if limit < 0 {
 			fmt.Printf("Limit cannot be less than zero")
 			return
+		} else if stream && verbose {
+			fmt.Printf("Not allowed to combine stream flag with verbose flag")
+			return
+		} else if spillThreshold < 0 {
+			fmt.Printf("Spill threshold cannot be less than zero")
+			return
+		} else if maxMatches < 0 {
+			fmt.Printf("Max matches cannot be less than zero")
+			return
+		} else if workers < 1 {
+			fmt.Printf("Workers cannot be less than one")
+			return
+		} else if idleTimeout < 0 {
+			fmt.Printf("Idle timeout cannot be less than zero")
+			return
+		} else if to != "" && latest {
+			fmt.Printf("Not allowed to combine to flag with latest flag")
+			return
+		} else if len(offsets) > 0 && (seekTimestamp != "" || earliest || latest) {
+			fmt.Printf("Not allowed to combine offset flag with seek timestamp, earliest or latest flags")
+			return
+		}
+
+		now := time.Now()
+		var fromTime, toTime time.Time
+		if seekTimestamp != "" {
+			var err error
+			fromTime, err = utility.ParseTime(seekTimestamp, now)
+			if err != nil {
+				fmt.Printf("Invalid start time: %v", err)
+				return
+			}
+		}
+
+		if to != "" {
+			var err error
+			toTime, err = utility.ParseTime(to, now)
+			if err != nil {
+				fmt.Printf("Invalid end time: %v", err)
+				return
+			} else if !fromTime.IsZero() && !toTime.After(fromTime) {
+				fmt.Printf("The end time must be after the start time")
+				return
+			}
+
+			if !cmd.Flags().Changed("limit") {
+				// Time windows are read in full unless a limit is provided
+				limit = 0
+			}
+		}
+
+		var assignment *kafka.Assignment
+		if len(partitionIds) > 0 || len(offsets) > 0 {
+			var err error
+			assignment, err = kafka.CreateAssignment(partitionIds, offsets)
+			if err != nil {
+				fmt.Printf("Invalid partition assignment: %v", err)
+				return
+			}
+
+			if assignment.HasRanges() && !cmd.Flags().Changed("limit") {
+				// Offset ranges are read in full unless a limit is provided
+				limit = 0
+			}
+		}
+
+		if stream && format == "" && output == "" {
+			// Streamed messages are printed as formatted lines by default
+			format = "text"
+		}
+
+		format, err := getFormat(format, output)
+		if err != nil {
+			fmt.Printf("Invalid format: %v", err)
+			return
+		}
+
+		connection, err := getConnection(cmd)
+		if err != nil {
+			fmt.Printf("Invalid connection settings: %v", err)
+			return
+		}
+
+		query, err := kafka.CreateQuery(keyQuery, valueQuery, headerQueries, regex, where, filter)
+		if err != nil {
+			fmt.Printf("Invalid query: %v", err)
+			return
+		}
+
+		decoders, err := getDecoders(cmd)
+		if err != nil {
+			fmt.Printf("Invalid format: %v", err)
+			return
+		}
+
+		promptOutput, progressOutput := getPromptOutputs(stream, output)
+
+		// Stop reading on SIGINT or SIGTERM and keep the messages matched so far
+		ctx, cancel := createSignalContext()
+		defer cancel()
+
+		var handler kafka.MessageHandler
+		closeHandler := func() {}
+		if stream {
+			handler, closeHandler = createStreamHandler(output, format)
 		}
 
 		// Create progress and trackers
-		writer := CreateProgress()
-		InitiateProgress(writer)
+		writer := CreateProgress(progressOutput)
 
-		// Create Kafka consumer
-		createConsumerTracker := CreateTracker("Connecting to Kafka", 2, writer)
-		consumer := kafka.CreateEarliestConsumer(bootstrap, topic, group, createConsumerTracker)
+		searcher, err := raccoon.NewSearcher(connection, raccoon.SearchOptions{
+			Topics:         topics,
+			TopicPattern:   topicPattern,
+			Group:          group,
+			Query:          query,
+			Decoders:       decoders,
+			Limit:          limit,
+			From:           fromTime,
+			To:             toTime,
+			Latest:         latest,
+			Assignment:     assignment,
+			Workers:        workers,
+			MaxMatches:     maxMatches,
+			SpillThreshold: spillThreshold,
+			IdleTimeout:    idleTimeout,
+			Handler:        handler,
+			Progress:       CreateTrackerProgress(writer),
+		})
+		if err != nil {
+			closeHandler()
+			fmt.Printf("Invalid search: %v", err)
+			return
+		}
 
-		// Retrieve Partition metadata
-		getPartitionsTracker := CreateTracker("Reading topic partition metadata", 100, writer)
-		partitions := kafka.GetPartitions(consumer, topic, getPartitionsTracker)
+		InitiateProgress(writer)
 
-		// Consumer from Kafka topic
-		consumeTracker := CreateTracker("Reading messages (0 matches)", limit, writer)
-		result := kafka.Consume(consumer, partitions, topic, keyQuery, valueQuery, limit, seekTimestamp, latest, consumeTracker)
+		// Search the Kafka topics
+		result, err := searcher.Search(ctx)
+		if err != nil {
+			closeHandler()
+			FinishProgress(writer)
+			_ = result.Close()
+			fmt.Printf("Unable to search topics: %v", err)
+			return
+		}
 
-		// Stop Kafka consumer
-		stopConsumerTracker := CreateTracker("Disconnecting from Kafka", 1, writer)
-		kafka.StopConsumer(consumer, stopConsumerTracker)
+		closeHandler()
 
-		if output != "" {
+		if output != "" && !stream {
 			// File output has been provided. Writing to file
 			writeToFileTracker := CreateTracker("Writing to file", limit, writer)
-			writeResultToFile(result, output, writeToFileTracker)
+			writeResultToFile(result, output, format, writeToFileTracker)
+		}
+
+		if result.Interrupted {
+			fmt.Fprintln(promptOutput, "Interrupted. The result only contains the messages read before the interruption")
+		} else if result.IdleTimedOut {
+			fmt.Fprintln(promptOutput, "Stopped reading a partition after nothing was read within the idle timeout")
 		}
 
-		printSummaryToPrompt(result)
+		printSummaryToPrompt(result, promptOutput)
 
 		if verbose {
 			// Print all the matched messages in the terminal
@@ -97,24 +257,39 @@ var grepCmd = &cobra.Command{
 		}
 
 		FinishProgress(writer)
+		_ = result.Close()
 	},
 }
 
 func init() {
-	grepCmd.Flags().StringP("bootstrap-server", "b", "", "Bootstrap server address (Required)")
-	grepCmd.Flags().StringP("topic", "t", "", "Topic name (Required)")
+	addConnectionFlags(grepCmd)
+	addDecoderFlags(grepCmd)
+	grepCmd.Flags().StringArrayP("topic", "t", []string{}, "Topic name. Can be repeated (Required unless a topic pattern is provided)")
+	grepCmd.Flags().String("topic-pattern", "", "Regular expression matching the names of the topics to subscribe to (Optional)")
 	grepCmd.Flags().StringP("group", "g", "", "Group name (Optional)")
 	grepCmd.Flags().StringP( "value-query", "q", "", "Value query (Optional)")
 	grepCmd.Flags().StringP( "key-query", "k", "", "Key query (Optional)")
+	grepCmd.Flags().StringArray("header-query", []string{}, "Header query as name=value. Can be repeated (Optional)")
+	grepCmd.Flags().BoolP("regex", "r", false, "Match the key, value and header queries as regular expressions (Optional)")
+	grepCmd.Flags().StringArrayP("where", "w", []string{}, "JSON value predicate, e.g. '$.amount > 1000'. Can be repeated (Optional)")
+	grepCmd.Flags().StringP("filter", "f", "", "Query expression, e.g. 'key contains \"42\" and not header.type == \"test\"' (Optional)")
 	grepCmd.Flags().StringP("output", "o", "", "Output file name (Optional)")
-	grepCmd.Flags().String("seek", "", "Seek and set offset to a timestamp. RFC3339 time format (Optional)")
-	grepCmd.Flags().Int64P("limit", "l", 1000, "Limit message consumption per partition (Optional)")
+	grepCmd.Flags().String("format", "", "Output format: csv, json, ndjson or text. Inferred from the file extension by default (Optional)")
+	grepCmd.Flags().BoolP("stream", "s", false, "Write each matched message to the output file, or stdout, as soon as it's matched (Optional)")
+	grepCmd.Flags().String("seek", "", "Seek and set offset to a time, e.g. 2021-01-01T14:00:00Z, -2h or today (Optional)")
+	grepCmd.Flags().String("from", "", "Start at a time, e.g. 2021-01-01T14:00:00Z, -2h or today. Same as seek (Optional)")
+	grepCmd.Flags().String("to", "", "Stop reading each partition after a time, e.g. 2021-01-01T14:15:00Z, -1h or now (Optional)")
+	grepCmd.Flags().Int64P("limit", "l", 1000, "Limit message consumption per partition. 0 is no limit (Optional)")
 	grepCmd.Flags().BoolP("verbose", "v", false, "Print output in terminal (Optional)")
+	grepCmd.Flags().Int64("spill-threshold", 100000, "Number of matched messages kept in memory before the remaining are spilled to a temporary file. 0 is never (Optional)")
+	grepCmd.Flags().Int64("max-matches", 0, "Stop reading once a number of messages have been matched. 0 is no limit (Optional)")
 	grepCmd.Flags().Bool("earliest", false, "Start at the earliest offset (Optional)")
 	grepCmd.Flags().Bool("latest", false, "Start at the latest offset minus the limit (Optional)")
+	grepCmd.Flags().Int32Slice("partition", []int32{}, "Only read the provided partitions, e.g. 3,7 (Optional)")
+	grepCmd.Flags().Int64("workers", 1, "Number of partitions read and messages matched in parallel (Optional)")
+	grepCmd.Flags().Duration("idle-timeout", 30 * time.Second, "Stop reading once nothing has been read for a duration, e.g. 1m. 0 is no timeout (Optional)")
+	grepCmd.Flags().StringArray("offset", []string{}, "Only read an offset range of a partition as partition:start-end, e.g. 3:15000-16000. Can be repeated (Optional)")
 
 
-	_ = grepCmd.MarkFlagRequired("bootstrap-server")
-	_ = grepCmd.MarkFlagRequired("topic")
 	rootCmd.AddCommand(grepCmd)
 }
@@ -0,0 +1,259 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/karldahlgren/raccoon/utility"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var inputFormats = []string{"csv", "json", "ndjson", "lines"}
+
+// csvTimestampLayout is the layout of the timestamps in exported CSV files
+const csvTimestampLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// messageReader reads messages to produce in a particular import format. The messages have the
+// same shape as exported messages, and io.EOF is returned once there are no more messages
+type messageReader interface {
+	read() (*kafka.Message, error)
+}
+
+type csvMessageReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	records int
+}
+
+type jsonMessageReader struct {
+	decoder *json.Decoder
+	started bool
+}
+
+type ndjsonMessageReader struct {
+	decoder *json.Decoder
+}
+
+type lineMessageReader struct {
+	scanner *bufio.Scanner
+}
+
+// flagMessageReader reads the single message provided by flags
+type flagMessageReader struct {
+	message *kafka.Message
+}
+
+// getInputFormat returns the format flag, or infers the format from the extension of the input file.
+// Lines are read by default
+func getInputFormat(format string, input string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(input)) {
+		case ".csv":
+			return "csv", nil
+		case ".json":
+			return "json", nil
+		case ".ndjson", ".jsonl":
+			return "ndjson", nil
+		default:
+			return "lines", nil
+		}
+	}
+
+	format = strings.ToLower(format)
+	for _, supported := range inputFormats {
+		if format == supported {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported format %q. Expected one of %s", format, strings.Join(inputFormats, ", "))
+}
+
+func createMessageReader(format string, reader io.Reader) (messageReader, error) {
+	switch format {
+	case "csv":
+		csvReader := csv.NewReader(reader)
+		header, err := csvReader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CSV header: %v", err)
+		}
+
+		columns := make(map[string]int)
+		for index, column := range header {
+			columns[strings.ToLower(strings.TrimSpace(column))] = index
+		}
+		return &csvMessageReader{reader: csvReader, columns: columns}, nil
+	case "json":
+		return &jsonMessageReader{decoder: json.NewDecoder(reader)}, nil
+	case "ndjson":
+		return &ndjsonMessageReader{decoder: json.NewDecoder(reader)}, nil
+	default:
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+		return &lineMessageReader{scanner: scanner}, nil
+	}
+}
+
+func (reader *csvMessageReader) read() (*kafka.Message, error) {
+	record, err := reader.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	reader.records++
+	column := func(name string) string {
+		if index, ok := reader.columns[name]; ok && index < len(record) {
+			return record[index]
+		}
+		return ""
+	}
+
+	message := &kafka.Message{Topic: column("topic"), Partition: kafka.AnyPartition, Key: column("key"), Value: column("value")}
+	if partition := column("partition"); partition != "" {
+		value, err := strconv.ParseInt(partition, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: invalid partition %q", reader.records, partition)
+		}
+		message.Partition = int32(value)
+	}
+
+	if timestamp := column("timestamp"); timestamp != "" {
+		message.Timestamp, err = parseImportedTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", reader.records, err)
+		}
+	}
+
+	if headers := column("headers"); headers != "" {
+		var parsedHeaders []exportedHeader
+		if err := json.Unmarshal([]byte(headers), &parsedHeaders); err != nil {
+			return nil, fmt.Errorf("record %d: invalid headers: %v", reader.records, err)
+		}
+		message.Headers = createHeaders(parsedHeaders)
+	}
+
+	return message, nil
+}
+
+func (reader *jsonMessageReader) read() (*kafka.Message, error) {
+	if !reader.started {
+		reader.started = true
+		if token, err := reader.decoder.Token(); err != nil {
+			return nil, err
+		} else if delimiter, ok := token.(json.Delim); !ok || delimiter != '[' {
+			return nil, fmt.Errorf("expected a JSON array of messages")
+		}
+	}
+
+	if !reader.decoder.More() {
+		return nil, io.EOF
+	}
+
+	return decodeImportedMessage(reader.decoder)
+}
+
+func (reader *ndjsonMessageReader) read() (*kafka.Message, error) {
+	return decodeImportedMessage(reader.decoder)
+}
+
+func (reader *lineMessageReader) read() (*kafka.Message, error) {
+	for reader.scanner.Scan() {
+		// Blank lines are skipped
+		if line := reader.scanner.Text(); strings.TrimSpace(line) != "" {
+			return &kafka.Message{Partition: kafka.AnyPartition, Value: line}, nil
+		}
+	}
+
+	if err := reader.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+func (reader *flagMessageReader) read() (*kafka.Message, error) {
+	if reader.message == nil {
+		return nil, io.EOF
+	}
+
+	message := reader.message
+	reader.message = nil
+	return message, nil
+}
+
+// decodeImportedMessage decodes an exported message. The raw value is used if there is one, otherwise JSON
+// string values are unquoted, while embedded JSON values are used as they are
+func decodeImportedMessage(decoder *json.Decoder) (*kafka.Message, error) {
+	exported := exportedMessage{Partition: kafka.AnyPartition}
+	if err := decoder.Decode(&exported); err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+
+	value := string(exported.Value)
+	var text string
+	if exported.RawValue != "" {
+		value = exported.RawValue
+	} else if err := json.Unmarshal(exported.Value, &text); err == nil {
+		value = text
+	}
+
+	return &kafka.Message{
+		Topic:     exported.Topic,
+		Partition: exported.Partition,
+		Key:       exported.Key,
+		Value:     value,
+		Timestamp: exported.Timestamp,
+		Headers:   createHeaders(exported.Headers),
+	}, nil
+}
+
+// parseImportedTimestamp parses a timestamp of an exported CSV file, or any time accepted by the seek flag
+func parseImportedTimestamp(timestamp string) (time.Time, error) {
+	if parsed, err := time.Parse(csvTimestampLayout, timestamp); err == nil {
+		return parsed, nil
+	}
+
+	return utility.ParseTime(timestamp, time.Now())
+}
+
+// createHeaders creates headers in the order they were exported
+func createHeaders(headers []exportedHeader) []kafka.Header {
+	var created []kafka.Header
+	for _, header := range headers {
+		created = append(created, kafka.Header{Key: header.Key, Value: header.Value})
+	}
+
+	return created
+}
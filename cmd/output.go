@@ -25,24 +25,28 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"github.com/jedib0t/go-pretty/v6/progress"
 	"github.com/karldahlgren/raccoon/kafka"
 	"github.com/karldahlgren/raccoon/utility"
 	"github.com/olekukonko/tablewriter"
+	"io"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-func writeResultToFile(result kafka.Result, output string, tracker *progress.Tracker) {
-	if result.Messages.Len() == 0 {
+func writeResultToFile(result kafka.Result, output string, format string, tracker *progress.Tracker) {
+	if result.CollectedMessages() == 0 {
 		tracker.MarkAsDone()
 		return
 	}
 
-	tracker.Total = int64(result.Messages.Len())
+	tracker.Total = result.CollectedMessages()
 	file, err := os.Create(output)
 	if err != nil {
 		tracker.MarkAsDone()
@@ -50,68 +54,134 @@ func writeResultToFile(result kafka.Result, output string, tracker *progress.Tra
 	}
 	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	writer, err := createMessageWriter(format, file)
+	if err != nil {
+		tracker.MarkAsDone()
+		utility.ExitOnError(err)
+	}
 
-	writeHeader(*writer)
-	for element := result.Messages.Front(); element != nil; element = element.Next() {
-		message := element.Value.(*kafka.Message)
-		row := getData(message)
-		writeRow(*writer, row)
+	err = result.Each(func(message *kafka.Message) error {
+		if err := writer.write(message); err != nil {
+			return err
+		}
 		tracker.Increment(1)
+		return nil
+	})
+	if err != nil {
+		tracker.MarkAsDone()
+		utility.ExitOnError(err)
 	}
-	tracker.MarkAsDone()
-}
 
-func writeHeader(writer csv.Writer) {
-	header := []string{"partition", "offset", "timestamp", "keu", "value"}
-	err := writer.Write(header)
+	err = writer.close()
 	if err != nil {
+		tracker.MarkAsDone()
 		utility.ExitOnError(err)
 	}
+	tracker.MarkAsDone()
 }
 
-func writeRow(writer csv.Writer, row []string) {
-	err := writer.Write(row)
-	if err != nil {
+// getPromptOutputs returns the outputs for the summary and the progress bars. Both are kept off stdout
+// when matched messages are streamed to stdout, and the progress bars are hidden since they would
+// otherwise be interleaved with the streamed messages
+func getPromptOutputs(stream bool, output string) (io.Writer, io.Writer) {
+	if stream && output == "" {
+		return os.Stderr, ioutil.Discard
+	}
+
+	return os.Stdout, os.Stdout
+}
+
+// createStreamHandler creates a handler which writes each matched message as soon as it has been matched,
+// either to the output file or to stdout if no output file has been provided. The returned function closes the writer
+func createStreamHandler(output string, format string) (kafka.MessageHandler, func()) {
+	file := os.Stdout
+	if output != "" {
+		var err error
+		file, err = os.Create(output)
 		utility.ExitOnError(err)
 	}
+
+	writer, err := createMessageWriter(format, file)
+	utility.ExitOnError(err)
+
+	var mutex sync.Mutex
+	handler := func(message *kafka.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		utility.ExitOnError(writer.write(message))
+		utility.ExitOnError(writer.flush())
+	}
+
+	closer := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		utility.ExitOnError(writer.close())
+		if file != os.Stdout {
+			utility.ExitOnError(file.Close())
+		}
+	}
+
+	return handler, closer
 }
 
-func printSummaryToPrompt(result kafka.Result) {
+func printSummaryToPrompt(result kafka.Result, writer io.Writer) {
 	searchTime := result.Duration.Round(time.Second).Seconds()
 	averagePerMessage := searchTime / float64(result.ReadMessages)
 	time.Sleep(100 * time.Millisecond)
-	fmt.Println()
-	fmt.Println("Summary:")
-	fmt.Println("  Read messages.......................:  " + strconv.FormatInt(result.ReadMessages, 10))
-	fmt.Println("  Matched messages....................:  " + strconv.FormatInt(result.MatchedMessages, 10))
-	fmt.Println("  Search time.........................:  " + fmt.Sprintf("%f", searchTime) + "s")
-	fmt.Println("  Messages/s..........................:  " + fmt.Sprintf("%f", averagePerMessage))
-	fmt.Println()
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, "Summary:")
+	fmt.Fprintln(writer, "  Read messages.......................:  " + strconv.FormatInt(result.ReadMessages, 10))
+	fmt.Fprintln(writer, "  Matched messages....................:  " + strconv.FormatInt(result.MatchedMessages, 10))
+	if result.InvalidMessages > 0 {
+		fmt.Fprintln(writer, "  Invalid JSON messages...............:  " + strconv.FormatInt(result.InvalidMessages, 10))
+	}
+	if result.UndecodableMessages > 0 {
+		fmt.Fprintln(writer, "  Undecodable messages................:  " + strconv.FormatInt(result.UndecodableMessages, 10))
+	}
+	fmt.Fprintln(writer, "  Search time.........................:  " + fmt.Sprintf("%f", searchTime) + "s")
+	fmt.Fprintln(writer, "  Messages/s..........................:  " + fmt.Sprintf("%f", averagePerMessage))
+	if len(result.StartOffsets) > 0 {
+		fmt.Fprintln(writer, "  Start offsets:")
+		printStartOffsetsToPrompt(result.StartOffsets, writer)
+	}
+	fmt.Fprintln(writer)
+}
+
+// printStartOffsetsToPrompt prints the offset each partition was read from, sorted by topic and partition
+func printStartOffsetsToPrompt(startOffsets map[kafka.PartitionID]int64, writer io.Writer) {
+	var ids []kafka.PartitionID
+	for id := range startOffsets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Topic != ids[j].Topic {
+			return ids[i].Topic < ids[j].Topic
+		}
+		return ids[i].Partition < ids[j].Partition
+	})
+
+	for _, id := range ids {
+		label := fmt.Sprintf("%s [%d]", id.Topic, id.Partition)
+		dots := 34 - len(label)
+		if dots < 1 {
+			dots = 1
+		}
+		fmt.Fprintln(writer, "    " + label + strings.Repeat(".", dots) + ":  " + strconv.FormatInt(startOffsets[id], 10))
+	}
 }
 
 func printResultToPrompt(result kafka.Result) {
-	if result.Messages.Len() == 0 {
+	if result.CollectedMessages() == 0 {
 		return
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Partition", "Offset", "Timestamp", "Key", "Value"})
+	table.SetHeader([]string{"Topic", "Partition", "Offset", "Timestamp", "Key", "Value", "Headers"})
 
-	for element := result.Messages.Front(); element != nil; element = element.Next() {
-		message := element.Value.(*kafka.Message)
-		row := getData(message)
-		table.Append(row)
-	}
+	err := result.Each(func(message *kafka.Message) error {
+		table.Append(getData(message))
+		return nil
+	})
+	utility.ExitOnError(err)
 	table.Render()
 }
-
-func getData(message *kafka.Message) []string {
-	return []string{
-		strconv.FormatInt(int64(message.Partition), 10),
-		message.Offset,
-		message.Timestamp.String(),
-		message.Key,
-		message.Value}
-}
@@ -0,0 +1,205 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/karldahlgren/raccoon/raccoon"
+	"github.com/karldahlgren/raccoon/utility"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var produceCmd = &cobra.Command{
+	Use:   "produce",
+	Short: "Publish messages to a Kafka topic",
+	Long:  `The produce command will publish a message provided by flags, one message per line read from stdin,
+			or the messages of a CSV, JSON or NDJSON file in the same shape as exported by the grep and tail commands.
+			The delivery of each message is reported in the terminal.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		topic := getStringFlag(cmd, "topic")
+		key := getStringFlag(cmd, "key")
+		value := getStringFlag(cmd, "value")
+		headers := getStringArrayFlag(cmd, "header")
+		partition := getInt32Flag(cmd, "partition")
+		timestamp := getStringFlag(cmd, "timestamp")
+		input := getStringFlag(cmd, "input")
+		format := getStringFlag(cmd, "format")
+		fromFlags := cmd.Flags().Changed("value")
+
+		if fromFlags && input != "" {
+			fmt.Printf("Not allowed to combine value flag with input flag")
+			return
+		} else if fromFlags && topic == "" {
+			fmt.Printf("A topic is required")
+			return
+		} else if partition < -1 {
+			fmt.Printf("Partition cannot be less than -1. -1 lets the producer choose the partition")
+			return
+		}
+
+		var parsedHeaders []kafka.Header
+		for _, header := range headers {
+			separator := strings.Index(header, "=")
+			if separator == -1 {
+				fmt.Printf("Invalid header %q. Expected name=value", header)
+				return
+			}
+			parsedHeaders = append(parsedHeaders, kafka.Header{Key: header[:separator], Value: header[separator+1:]})
+		}
+
+		var parsedTimestamp time.Time
+		if timestamp != "" {
+			var err error
+			parsedTimestamp, err = utility.ParseTime(timestamp, time.Now())
+			if err != nil {
+				fmt.Printf("Invalid timestamp: %v", err)
+				return
+			}
+		}
+
+		connection, err := getConnection(cmd)
+		if err != nil {
+			fmt.Printf("Invalid connection settings: %v", err)
+			return
+		}
+
+		// Read the messages from the flags, the input file or stdin
+		var reader messageReader
+		if fromFlags {
+			reader = &flagMessageReader{message: &kafka.Message{Partition: kafka.AnyPartition, Value: value}}
+		} else {
+			format, err = getInputFormat(format, input)
+			if err != nil {
+				fmt.Printf("Invalid format: %v", err)
+				return
+			}
+
+			var file io.Reader = os.Stdin
+			if input != "" {
+				opened, err := os.Open(input)
+				if err != nil {
+					fmt.Printf("Unable to open input: %v", err)
+					return
+				}
+				defer opened.Close()
+				file = opened
+			}
+
+			reader, err = createMessageReader(format, file)
+			if err != nil {
+				fmt.Printf("Invalid input: %v", err)
+				return
+			}
+		}
+
+		// Values provided by flags override the values of each message
+		source := func() (*kafka.Message, error) {
+			message, err := reader.read()
+			if err != nil {
+				return nil, err
+			}
+
+			if topic != "" {
+				message.Topic = topic
+			}
+			if message.Topic == "" {
+				return nil, fmt.Errorf("a topic is required")
+			}
+			if cmd.Flags().Changed("key") {
+				message.Key = key
+			}
+			if cmd.Flags().Changed("partition") {
+				message.Partition = partition
+			}
+			if !parsedTimestamp.IsZero() {
+				message.Timestamp = parsedTimestamp
+			}
+			message.Headers = append(message.Headers, parsedHeaders...)
+
+			return message, nil
+		}
+
+		producer, err := raccoon.NewProducer(connection, raccoon.ProduceOptions{Handler: printDelivery})
+		if err != nil {
+			fmt.Printf("Invalid producer: %v", err)
+			return
+		}
+
+		// Stop reading messages on SIGINT or SIGTERM and wait for the published messages
+		ctx, cancel := createSignalContext()
+		defer cancel()
+
+		result, err := producer.Produce(ctx, source)
+		if err != nil {
+			fmt.Printf("Unable to produce messages: %v\n", err)
+		} else if ctx.Err() != nil {
+			fmt.Println("Interrupted. Only the messages read before the interruption have been published")
+		}
+
+		printProduceSummaryToPrompt(result)
+	},
+}
+
+// printDelivery prints the delivery report of a message in the terminal
+func printDelivery(delivery kafka.Delivery) {
+	if delivery.Err != nil {
+		fmt.Printf("Failed to deliver message %d to %s: %v\n", delivery.Index + 1, delivery.Message.Topic, delivery.Err)
+		return
+	}
+
+	fmt.Printf("Delivered message %d to %s [%d] at offset %d\n", delivery.Index + 1, delivery.Message.Topic,
+		delivery.Message.Partition, delivery.Message.Offset)
+}
+
+func printProduceSummaryToPrompt(result kafka.ProduceResult) {
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Println("  Produced messages...................:  " + strconv.FormatInt(result.ProducedMessages, 10))
+	if result.FailedMessages > 0 {
+		fmt.Println("  Failed messages.....................:  " + strconv.FormatInt(result.FailedMessages, 10))
+	}
+	fmt.Println("  Produce time........................:  " + fmt.Sprintf("%f", result.Duration.Seconds()) + "s")
+	fmt.Println()
+}
+
+func init() {
+	addConnectionFlags(produceCmd)
+	produceCmd.Flags().StringP("topic", "t", "", "Topic name. Overrides the topics of the input (Required unless the input contains topics)")
+	produceCmd.Flags().StringP("key", "k", "", "Message key. Overrides the keys of the input (Optional)")
+	produceCmd.Flags().String("value", "", "Message value. Publishes a single message instead of reading the input (Optional)")
+	produceCmd.Flags().StringArray("header", []string{}, "Message header as name=value. Can be repeated (Optional)")
+	produceCmd.Flags().Int32("partition", -1, "Partition. -1 lets the producer choose the partition (Optional)")
+	produceCmd.Flags().String("timestamp", "", "Message timestamp, e.g. 2021-01-01T14:00:00Z, -2h or now (Optional)")
+	produceCmd.Flags().StringP("input", "i", "", "Input file. Stdin is read if no input file or value is provided (Optional)")
+	produceCmd.Flags().String("format", "", "Input format: csv, json, ndjson or lines. Inferred from the file extension, lines by default (Optional)")
+
+	rootCmd.AddCommand(produceCmd)
+}
@@ -25,14 +25,19 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/jedib0t/go-pretty/v6/progress"
 	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/karldahlgren/raccoon/raccoon"
+	"io"
 	"time"
 )
 
-// CreateProgress creates a new progress, which is used to create progress bars and trackers
-func CreateProgress() progress.Writer {
+// CreateProgress creates a new progress, which is used to create progress bars and trackers.
+// The progress bars are rendered to the provided output
+func CreateProgress(output io.Writer) progress.Writer {
 	pw := progress.NewWriter()
+	pw.SetOutputWriter(output)
 	pw.SetTrackerLength(30)
 	pw.ShowOverallTracker(false)
 	pw.ShowTime(true)
@@ -72,3 +77,65 @@ func FinishProgress(writer progress.Writer) {
 		writer.Stop()
 	}
 }
+
+// trackerProgress renders the progress of a search or a tail as one tracker per stage
+type trackerProgress struct {
+	writer   progress.Writer
+	trackers map[raccoon.Stage]*progress.Tracker
+}
+
+// CreateTrackerProgress creates a progress which appends a tracker to the writer for each stage
+func CreateTrackerProgress(writer progress.Writer) raccoon.Progress {
+	return &trackerProgress{writer: writer, trackers: make(map[raccoon.Stage]*progress.Tracker)}
+}
+
+// Started appends a tracker for the stage
+func (trackerProgress *trackerProgress) Started(stage raccoon.Stage) {
+	trackerProgress.trackers[stage] = CreateTracker(getStageMessage(stage, 0, 0), 1, trackerProgress.writer)
+}
+
+// Updated updates the tracker of the stage. The total is increased by one, so that the tracker
+// isn't marked as done before the stage is done
+func (trackerProgress *trackerProgress) Updated(stage raccoon.Stage, current int64, total int64, matches int64) {
+	tracker := trackerProgress.trackers[stage]
+	if tracker == nil {
+		return
+	}
+
+	if total >= 0 {
+		tracker.Total = total + 1
+	} else {
+		tracker.Total = total
+	}
+	tracker.Message = getStageMessage(stage, current, matches)
+	tracker.SetValue(current)
+}
+
+// Done marks the tracker of the stage as done
+func (trackerProgress *trackerProgress) Done(stage raccoon.Stage) {
+	tracker := trackerProgress.trackers[stage]
+	if tracker == nil {
+		return
+	}
+
+	// Sleep 100 ms for rendering reasons
+	time.Sleep(100 * time.Millisecond)
+	tracker.MarkAsDone()
+}
+
+func getStageMessage(stage raccoon.Stage, current int64, matches int64) string {
+	switch stage {
+	case raccoon.StageConnecting:
+		return "Connecting to Kafka"
+	case raccoon.StageReadingMetadata:
+		return fmt.Sprintf("Reading topic partition metadata (%d partitions)", current)
+	case raccoon.StageConnectingWorkers:
+		return "Connecting workers to Kafka"
+	case raccoon.StageCatchingUp:
+		return fmt.Sprintf("Catching up (%d matches)", matches)
+	case raccoon.StageReading:
+		return fmt.Sprintf("Reading messages (%d matches)", matches)
+	default:
+		return "Disconnecting from Kafka"
+	}
+}
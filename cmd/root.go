@@ -34,17 +34,26 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "raccoon",
 	Short: "Raccoon is a Kafka-tool to search and find messages in Kafka topics",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Load the cluster context before the flags of the command are resolved
+		loadContext(cmd)
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().String("context", "", "Cluster context from the configuration file (Optional)")
 }
 
 // Execute method prints the logo and starts all commands
 func Execute() {
-	fmt.Println(" ____")
-	fmt.Println("|  _ \\ __ _  ___ ___ ___   ___  _ __")
-	fmt.Println("| |_) / _` |/ __/ __/ _ \\ / _ \\| '_ \\")
-	fmt.Println("|  _ < (_| | (_| (_| (_) | (_) | | | |")
-	fmt.Println("|_| \\_\\__,_|\\___\\___\\___/ \\___/|_| |_|")
-	fmt.Println("Raccoon: Kafka search tool " + config.Version)
-	fmt.Println()
+	// The logo is printed to stderr to keep stdout clean for streamed messages
+	fmt.Fprintln(os.Stderr, " ____")
+	fmt.Fprintln(os.Stderr, "|  _ \\ __ _  ___ ___ ___   ___  _ __")
+	fmt.Fprintln(os.Stderr, "| |_) / _` |/ __/ __/ _ \\ / _ \\| '_ \\")
+	fmt.Fprintln(os.Stderr, "|  _ < (_| | (_| (_| (_) | (_) | | | |")
+	fmt.Fprintln(os.Stderr, "|_| \\_\\__,_|\\___\\___\\___/ \\___/|_| |_|")
+	fmt.Fprintln(os.Stderr, "Raccoon: Kafka search tool " + config.Version)
+	fmt.Fprintln(os.Stderr)
 	config.CheckForUpdates()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -25,53 +25,189 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/karldahlgren/raccoon/kafka"
+	"github.com/karldahlgren/raccoon/raccoon"
+	"github.com/karldahlgren/raccoon/utility"
 	"github.com/spf13/cobra"
+	"time"
 )
 
 var tailCmd = &cobra.Command{
 	Use:   "tail",
 	Short: "Tail a Kafka topic and match all new messages",
 	Long:  `The tail command will subscribe to a topic with the latest offset and listen for all new message
-			published on the topic. All matched messages can be displayed in the terminal and/or exported to a CSV file.`,
+			published on the topic. Optionally, the command will first catch up from an earlier position.
+			All matched messages can be displayed in the terminal and/or exported to a CSV, JSON or NDJSON file.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		bootstrap := getStringFlag(cmd,"bootstrap-server")
-		group := getStringFlag(cmd,"group")
-		topic := getStringFlag(cmd,"topic")
+		group := getGroup(cmd)
+		topics := getStringArrayFlag(cmd, "topic")
+		topicPattern := getStringFlag(cmd, "topic-pattern")
 		keyQuery := getStringFlag(cmd,"key-query")
 		valueQuery := getStringFlag(cmd,"value-query")
+		headerQueries := getStringArrayFlag(cmd, "header-query")
+		regex := getBoolFlag(cmd, "regex")
+		where := getStringArrayFlag(cmd, "where")
+		filter := getStringFlag(cmd, "filter")
 		output := getStringFlag(cmd,"output")
+		format := getStringFlag(cmd, "format")
+		stream := getBoolFlag(cmd, "stream")
 		limit := getInt64Flag(cmd, "limit")
 		verbose := getBoolFlag(cmd, "verbose")
+		duration := getDurationFlag(cmd, "duration")
+		idleTimeout := getDurationFlag(cmd, "idle-timeout")
+		spillThreshold := getInt64Flag(cmd, "spill-threshold")
+		seekTimestamp := getStringFlag(cmd, "seek")
+		earliest := getBoolFlag(cmd, "earliest")
+		latestMinus := getInt64Flag(cmd, "latest-minus")
+
+		if len(topics) == 0 && topicPattern == "" {
+			fmt.Printf("A topic or a topic pattern is required")
+			return
+		} else if stream && verbose {
+			fmt.Printf("Not allowed to combine stream flag with verbose flag")
+			return
+		} else if spillThreshold < 0 {
+			fmt.Printf("Spill threshold cannot be less than zero")
+			return
+		} else if seekTimestamp != "" && earliest {
+			fmt.Printf("Not allowed to combine seek timestamp flag with earliest flag")
+			return
+		} else if seekTimestamp != "" && cmd.Flags().Changed("latest-minus") {
+			fmt.Printf("Not allowed to combine seek timestamp flag with latest minus flag")
+			return
+		} else if earliest && cmd.Flags().Changed("latest-minus") {
+			fmt.Printf("Not allowed to combine earliest flag with latest minus flag")
+			return
+		} else if latestMinus < 0 {
+			fmt.Printf("Latest minus cannot be less than zero")
+			return
+		} else if duration < 0 {
+			fmt.Printf("Duration cannot be less than zero")
+			return
+		} else if idleTimeout < 0 {
+			fmt.Printf("Idle timeout cannot be less than zero")
+			return
+		}
+
+		if limit < 0 {
+			// A negative limit has always meant no limit
+			limit = 0
+		}
+
+		var seekTime time.Time
+		if seekTimestamp != "" {
+			var err error
+			seekTime, err = utility.ParseTime(seekTimestamp, time.Now())
+			if err != nil {
+				fmt.Printf("Invalid start time: %v", err)
+				return
+			}
+		}
+
+		if stream && format == "" && output == "" {
+			// Streamed messages are printed as formatted lines by default
+			format = "text"
+		}
+
+		format, err := getFormat(format, output)
+		if err != nil {
+			fmt.Printf("Invalid format: %v", err)
+			return
+		}
+
+		connection, err := getConnection(cmd)
+		if err != nil {
+			fmt.Printf("Invalid connection settings: %v", err)
+			return
+		}
+
+		query, err := kafka.CreateQuery(keyQuery, valueQuery, headerQueries, regex, where, filter)
+		if err != nil {
+			fmt.Printf("Invalid query: %v", err)
+			return
+		}
+
+		decoders, err := getDecoders(cmd)
+		if err != nil {
+			fmt.Printf("Invalid format: %v", err)
+			return
+		}
+
+		promptOutput, progressOutput := getPromptOutputs(stream, output)
+
+		// Stop reading on SIGINT, SIGTERM, enter or once the duration has passed
+		ctx, cancel := createSignalContext()
+		defer cancel()
+		if duration > 0 {
+			ctx, cancel = context.WithTimeout(ctx, duration)
+			defer cancel()
+		}
+
+		// Unless stdin is a terminal, only a signal, the duration or the limit stops the tail
+		if stopOnEnter(cancel) {
+			fmt.Fprintln(promptOutput, "Press enter or Ctrl+C to stop reading messages")
+		} else {
+			fmt.Fprintln(promptOutput, "Press Ctrl+C to stop reading messages")
+		}
+		fmt.Fprintln(promptOutput)
+
+		var handler kafka.MessageHandler
+		closeHandler := func() {}
+		if stream {
+			handler, closeHandler = createStreamHandler(output, format)
+		}
 
-		fmt.Println("Press enter to stop reading messages")
-		fmt.Println()
-		
 		// Create progress and trackers
-		writer := CreateProgress()
+		writer := CreateProgress(progressOutput)
 
-		InitiateProgress(writer)
+		tailer, err := raccoon.NewTailer(connection, raccoon.TailOptions{
+			Topics:         topics,
+			TopicPattern:   topicPattern,
+			Group:          group,
+			Query:          query,
+			Decoders:       decoders,
+			Limit:          limit,
+			From:           seekTime,
+			Earliest:       earliest,
+			LatestMinus:    latestMinus,
+			SpillThreshold: spillThreshold,
+			IdleTimeout:    idleTimeout,
+			Handler:        handler,
+			Progress:       CreateTrackerProgress(writer),
+		})
+		if err != nil {
+			closeHandler()
+			fmt.Printf("Invalid tail: %v", err)
+			return
+		}
 
-		// Create Kafka consumer
-		createConsumerTracker := CreateTracker("Connecting to Kafka", 2, writer)
-		consumer := kafka.CreateLatestConsumer(bootstrap, topic, group, createConsumerTracker)
+		InitiateProgress(writer)
 
-		// Consumer from Kafka topic
-		consumeTracker := CreateTracker("Reading messages (0 matches)", limit, writer)
-		result := kafka.Tail(consumer, keyQuery, valueQuery, limit, consumeTracker)
+		// Tail the Kafka topics
+		result, err := tailer.Tail(ctx)
+		if err != nil {
+			closeHandler()
+			FinishProgress(writer)
+			_ = result.Close()
+			fmt.Printf("Unable to tail topics: %v", err)
+			return
+		}
 
-		// Stop Kafka consumer
-		stopConsumerTracker := CreateTracker("Disconnecting from Kafka", 1, writer)
-		kafka.StopConsumer(consumer, stopConsumerTracker)
+		closeHandler()
 
-		if output != "" {
+		if output != "" && !stream {
 			// File output has been provided. Writing to file
 			writeToFileTracker := CreateTracker("Writing to file", limit, writer)
-			writeResultToFile(result, output, writeToFileTracker)
+			writeResultToFile(result, output, format, writeToFileTracker)
+		}
+
+		if result.IdleTimedOut {
+			fmt.Fprintln(promptOutput, "Stopped catching up a partition after nothing was read within the idle timeout")
 		}
 
-		printSummaryToPrompt(result)
+		printSummaryToPrompt(result, promptOutput)
 
 		if verbose {
 			// Print all the matched messages in the terminal
@@ -79,20 +215,33 @@ var tailCmd = &cobra.Command{
 		}
 
 		FinishProgress(writer)
+		_ = result.Close()
 	},
 }
 
 func init() {
-	tailCmd.Flags().StringP("bootstrap-server", "b", "", "Bootstrap server address (Required)")
-	tailCmd.Flags().StringP("topic", "t", "", "Topic name (Required)")
+	addConnectionFlags(tailCmd)
+	addDecoderFlags(tailCmd)
+	tailCmd.Flags().StringArrayP("topic", "t", []string{}, "Topic name. Can be repeated (Required unless a topic pattern is provided)")
+	tailCmd.Flags().String("topic-pattern", "", "Regular expression matching the names of the topics to subscribe to (Optional)")
 	tailCmd.Flags().StringP("group", "g", "", "Group name (Optional)")
 	tailCmd.Flags().StringP( "value-query", "q", "", "Value query (Optional)")
 	tailCmd.Flags().StringP( "key-query", "k", "", "Key query (Optional)")
+	tailCmd.Flags().StringArray("header-query", []string{}, "Header query as name=value. Can be repeated (Optional)")
+	tailCmd.Flags().BoolP("regex", "r", false, "Match the key, value and header queries as regular expressions (Optional)")
+	tailCmd.Flags().StringArrayP("where", "w", []string{}, "JSON value predicate, e.g. '$.amount > 1000'. Can be repeated (Optional)")
+	tailCmd.Flags().StringP("filter", "f", "", "Query expression, e.g. 'key contains \"42\" and not header.type == \"test\"' (Optional)")
 	tailCmd.Flags().StringP("output", "o", "", "Output file name (Optional)")
-	tailCmd.Flags().Int64P("limit", "l", -1, "Limit message consumption per partition. -1 is no limit (Optional)")
+	tailCmd.Flags().String("format", "", "Output format: csv, json, ndjson or text. Inferred from the file extension by default (Optional)")
+	tailCmd.Flags().BoolP("stream", "s", false, "Write each matched message to the output file, or stdout, as soon as it's matched (Optional)")
+	tailCmd.Flags().Int64P("limit", "l", 0, "Stop once a number of new messages have been read. 0 is no limit (Optional)")
 	tailCmd.Flags().BoolP("verbose", "v", false, "Print output in terminal (Optional)")
+	tailCmd.Flags().Int64("spill-threshold", 100000, "Number of matched messages kept in memory before the remaining are spilled to a temporary file. 0 is never (Optional)")
+	tailCmd.Flags().Duration("duration", 0, "Stop reading messages after a duration, e.g. 10m. 0 is no duration (Optional)")
+	tailCmd.Flags().Duration("idle-timeout", 30 * time.Second, "Stop catching up once nothing has been read for a duration, e.g. 1m. 0 is no timeout (Optional)")
+	tailCmd.Flags().String("seek", "", "Catch up from a time before following new messages, e.g. 2021-01-01T14:00:00Z, -2h or today (Optional)")
+	tailCmd.Flags().Bool("earliest", false, "Catch up from the earliest offset before following new messages (Optional)")
+	tailCmd.Flags().Int64("latest-minus", 0, "Catch up from the latest offset minus a number of messages per partition before following new messages (Optional)")
 
-	_ = tailCmd.MarkFlagRequired("bootstrap-server")
-	_ = tailCmd.MarkFlagRequired("topic")
 	rootCmd.AddCommand(tailCmd)
 }
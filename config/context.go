@@ -0,0 +1,171 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Configuration contains the named cluster contexts stored in the configuration file
+type Configuration struct {
+	CurrentContext string     `yaml:"current-context,omitempty"`
+	Contexts       []*Context `yaml:"contexts"`
+}
+
+// Context contains the connection settings and defaults for a named Kafka cluster
+type Context struct {
+	Name                   string            `yaml:"name"`
+	BootstrapServer        string            `yaml:"bootstrap-server"`
+	SecurityProtocol       string            `yaml:"security-protocol,omitempty"`
+	SaslMechanism          string            `yaml:"sasl-mechanism,omitempty"`
+	SaslUsername           string            `yaml:"sasl-username,omitempty"`
+	SaslPassword           string            `yaml:"sasl-password,omitempty"`
+	OAuthBearerToken       string            `yaml:"sasl-oauthbearer-token,omitempty"`
+	SslCALocation          string            `yaml:"ssl-ca-location,omitempty"`
+	SslCertificateLocation string            `yaml:"ssl-certificate-location,omitempty"`
+	SslKeyLocation         string            `yaml:"ssl-key-location,omitempty"`
+	SslKeyPassword         string            `yaml:"ssl-key-password,omitempty"`
+	SslVerifyHostname      string            `yaml:"ssl-endpoint-identification-algorithm,omitempty"`
+	Properties             map[string]string `yaml:"properties,omitempty"`
+	SchemaRegistry         string            `yaml:"schema-registry,omitempty"`
+	GroupPrefix            string            `yaml:"group-prefix,omitempty"`
+	Limit                  int64             `yaml:"limit,omitempty"`
+}
+
+// ConfigurationPath returns the path to the configuration file, which is located
+// in $XDG_CONFIG_HOME/raccoon or ~/.config/raccoon
+func ConfigurationPath() (string, error) {
+	directory := os.Getenv("XDG_CONFIG_HOME")
+	if directory == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		directory = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(directory, "raccoon", "config.yaml"), nil
+}
+
+// LoadConfiguration reads the configuration file. An empty configuration is returned if the file doesn't exist
+func LoadConfiguration(path string) (*Configuration, error) {
+	configuration := &Configuration{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return configuration, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, configuration); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+
+	return configuration, nil
+}
+
+// Save writes the configuration file and creates the configuration directory if needed. The file is
+// only readable by the current user since it can contain credentials
+func (configuration *Configuration) Save(path string) error {
+	data, err := yaml.Marshal(configuration)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// GetContext returns the context with the provided name, or nil if there is no such context
+func (configuration *Configuration) GetContext(name string) *Context {
+	for _, context := range configuration.Contexts {
+		if context.Name == name {
+			return context
+		}
+	}
+
+	return nil
+}
+
+// AddContext adds a new context. An error is returned if a context with the same name already exists
+func (configuration *Configuration) AddContext(context *Context) error {
+	if configuration.GetContext(context.Name) != nil {
+		return fmt.Errorf("context %q already exists", context.Name)
+	}
+
+	configuration.Contexts = append(configuration.Contexts, context)
+	return nil
+}
+
+// RemoveContext removes a context and unsets the current context if it was removed
+func (configuration *Configuration) RemoveContext(name string) error {
+	for index, context := range configuration.Contexts {
+		if context.Name == name {
+			configuration.Contexts = append(configuration.Contexts[:index], configuration.Contexts[index+1:]...)
+			if configuration.CurrentContext == name {
+				configuration.CurrentContext = ""
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("context %q doesn't exist", name)
+}
+
+// UseContext sets the current context, which is used when no context is provided as a flag
+func (configuration *Configuration) UseContext(name string) error {
+	if configuration.GetContext(name) == nil {
+		return fmt.Errorf("context %q doesn't exist", name)
+	}
+
+	configuration.CurrentContext = name
+	return nil
+}
+
+// SelectContext returns the context with the provided name, or the current context if no name is provided.
+// Nil is returned if no name is provided and no current context has been set
+func (configuration *Configuration) SelectContext(name string) (*Context, error) {
+	if name == "" {
+		name = configuration.CurrentContext
+	}
+
+	if name == "" {
+		return nil, nil
+	}
+
+	context := configuration.GetContext(name)
+	if context == nil {
+		return nil, fmt.Errorf("context %q doesn't exist", name)
+	}
+
+	return context, nil
+}
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
@@ -68,7 +69,7 @@ func CheckForUpdates() {
 		newVersion := s[len(s)-1]
 
 		if currentVersion != newVersion {
-			fmt.Printf("New version available %s, check %s\n\n", newVersion, updateURL)
+			fmt.Fprintf(os.Stderr, "New version available %s, check %s\n\n", newVersion, updateURL)
 		}
 	}
 }
@@ -5,7 +5,10 @@ go 1.15
 require (
 	github.com/confluentinc/confluent-kafka-go v1.5.2 // indirect
 	github.com/jedib0t/go-pretty/v6 v6.0.5
+	github.com/linkedin/goavro/v2 v2.11.1
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/spf13/cobra v1.1.1
+	google.golang.org/protobuf v1.31.0
 	gopkg.in/confluentinc/confluent-kafka-go.v1 v1.5.2
+	gopkg.in/yaml.v2 v2.4.0
 )
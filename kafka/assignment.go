@@ -0,0 +1,158 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Assignment selects the partitions to read, and optionally an offset range within each partition.
+// The selected partitions are assigned directly to the consumer instead of through a group subscription
+type Assignment struct {
+	partitions map[int32]bool
+	ranges     map[int32]offsetRange
+}
+
+// offsetRange is an inclusive range of offsets. An end of -1 reads to the end of the partition
+type offsetRange struct {
+	start int64
+	end   int64
+}
+
+// CreateAssignment creates an assignment from a list of partitions and a list of offset ranges. An offset
+// range has the format partition:start-end, e.g. 3:15000-16000. The end offset is inclusive and can be left
+// out, e.g. 3:15000-, to read to the end of the partition
+func CreateAssignment(partitions []int32, offsets []string) (*Assignment, error) {
+	assignment := &Assignment{
+		partitions: make(map[int32]bool),
+		ranges:     make(map[int32]offsetRange),
+	}
+
+	for _, partition := range partitions {
+		if partition < 0 {
+			return nil, fmt.Errorf("invalid partition %d", partition)
+		}
+		assignment.partitions[partition] = true
+	}
+
+	for _, offset := range offsets {
+		partition, offsetRange, err := parseOffsetRange(offset)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := assignment.ranges[partition]; ok {
+			return nil, fmt.Errorf("multiple offset ranges provided for partition %d", partition)
+		}
+		assignment.partitions[partition] = true
+		assignment.ranges[partition] = offsetRange
+	}
+
+	return assignment, nil
+}
+
+// HasRanges returns true if an offset range has been provided for at least one partition
+func (assignment *Assignment) HasRanges() bool {
+	return len(assignment.ranges) > 0
+}
+
+// Select returns the assigned partitions of all topics, with the offsets limited to the assigned ranges.
+// An error is returned if a partition doesn't exist in one of the topics
+func (assignment *Assignment) Select(partitions map[PartitionID]Partition) (map[PartitionID]Partition, error) {
+	topics := make(map[string]bool)
+	for id := range partitions {
+		topics[id.Topic] = true
+	}
+
+	var assigned []int
+	for partition := range assignment.partitions {
+		assigned = append(assigned, int(partition))
+	}
+	sort.Ints(assigned)
+
+	selected := make(map[PartitionID]Partition)
+	for topic := range topics {
+		for _, id := range assigned {
+			partitionId := PartitionID{Topic: topic, Partition: int32(id)}
+			partition, ok := partitions[partitionId]
+			if !ok {
+				return nil, fmt.Errorf("partition %d does not exist in topic %s", id, topic)
+			}
+
+			if offsetRange, ok := assignment.ranges[partitionId.Partition]; ok {
+				if offsetRange.start > partition.lowOffset {
+					partition.lowOffset = offsetRange.start
+				}
+				if offsetRange.end != -1 && offsetRange.end + 1 < partition.highOffset {
+					partition.highOffset = offsetRange.end + 1
+				}
+				if partition.lowOffset > partition.highOffset {
+					partition.lowOffset = partition.highOffset
+				}
+			}
+
+			selected[partitionId] = partition
+		}
+	}
+
+	return selected, nil
+}
+
+func parseOffsetRange(text string) (int32, offsetRange, error) {
+	invalid := fmt.Errorf("invalid offset range %q. Expected partition:start-end, e.g. 3:15000-16000", text)
+
+	separator := strings.Index(text, ":")
+	if separator == -1 {
+		return 0, offsetRange{}, invalid
+	}
+
+	partition, err := strconv.ParseInt(strings.TrimSpace(text[:separator]), 10, 32)
+	if err != nil || partition < 0 {
+		return 0, offsetRange{}, invalid
+	}
+
+	bounds := strings.SplitN(text[separator+1:], "-", 2)
+	if len(bounds) != 2 {
+		return 0, offsetRange{}, invalid
+	}
+
+	start, err := strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 64)
+	if err != nil || start < 0 {
+		return 0, offsetRange{}, invalid
+	}
+
+	end := int64(-1)
+	if strings.TrimSpace(bounds[1]) != "" {
+		end, err = strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 64)
+		if err != nil || end < start {
+			return 0, offsetRange{}, invalid
+		}
+	}
+
+	return int32(partition), offsetRange{start: start, end: end}, nil
+}
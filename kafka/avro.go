@@ -0,0 +1,93 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"github.com/linkedin/goavro/v2"
+	"sync"
+)
+
+// AvroDecoder decodes Avro data serialized with the Confluent wire format into JSON. The schemas
+// are retrieved from a schema registry and compiled once
+type AvroDecoder struct {
+	registry *SchemaRegistry
+	mutex    sync.Mutex
+	codecs   map[int32]*goavro.Codec
+}
+
+// CreateAvroDecoder creates a new Avro decoder which retrieves schemas from the provided schema registry
+func CreateAvroDecoder(registry *SchemaRegistry) *AvroDecoder {
+	return &AvroDecoder{
+		registry: registry,
+		codecs:   make(map[int32]*goavro.Codec),
+	}
+}
+
+// Decode decodes Avro data into JSON
+func (decoder *AvroDecoder) Decode(data []byte) ([]byte, error) {
+	id, payload, err := parseWireFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := decoder.getCodec(id)
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode Avro data with schema %d: %v", id, err)
+	}
+
+	return codec.TextualFromNative(nil, native)
+}
+
+func (decoder *AvroDecoder) getCodec(id int32) (*goavro.Codec, error) {
+	decoder.mutex.Lock()
+	defer decoder.mutex.Unlock()
+
+	if codec, ok := decoder.codecs[id]; ok {
+		return codec, nil
+	}
+
+	schema, err := decoder.registry.getSchema(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema.SchemaType != "AVRO" {
+		return nil, fmt.Errorf("schema %d is a %s schema, not an Avro schema", id, schema.SchemaType)
+	}
+
+	codec, err := goavro.NewCodec(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema %d: %v", id, err)
+	}
+
+	decoder.codecs[id] = codec
+	return codec, nil
+}
@@ -0,0 +1,179 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/linkedin/goavro/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const orderSchema = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"},
+	{"name": "amount", "type": "long"}]}`
+
+// stubRegistry is a schema registry serving the order schema as schema 1, a protobuf schema as schema 2,
+// and the order schema as schema 3 after failing the first request. Other schemas are unknown
+type stubRegistry struct {
+	mutex    sync.Mutex
+	requests map[string]int
+}
+
+func (registry *stubRegistry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	registry.mutex.Lock()
+	registry.requests[request.URL.Path]++
+	count := registry.requests[request.URL.Path]
+	registry.mutex.Unlock()
+
+	switch request.URL.Path {
+	case "/schemas/ids/1":
+		_ = json.NewEncoder(writer).Encode(map[string]string{"schema": orderSchema})
+	case "/schemas/ids/2":
+		_ = json.NewEncoder(writer).Encode(map[string]string{"schema": `syntax = "proto3";`, "schemaType": "PROTOBUF"})
+	case "/schemas/ids/3":
+		if count == 1 {
+			http.Error(writer, `{"error_code": 50001, "message": "Store error"}`, http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(map[string]string{"schema": orderSchema})
+	default:
+		http.Error(writer, `{"error_code": 40403, "message": "Schema not found"}`, http.StatusNotFound)
+	}
+}
+
+func (registry *stubRegistry) getRequests(id int32) int {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	return registry.requests[fmt.Sprintf("/schemas/ids/%d", id)]
+}
+
+// createTestDecoder creates an Avro decoder retrieving schemas from a stub registry
+func createTestDecoder() (*AvroDecoder, *stubRegistry, func()) {
+	registry := &stubRegistry{requests: make(map[string]int)}
+	server := httptest.NewServer(registry)
+	return CreateAvroDecoder(CreateSchemaRegistry(server.URL)), registry, server.Close
+}
+
+// encodeOrder serializes an order with the schema registry wire format
+func encodeOrder(t *testing.T, id int32, orderId string, amount int64) []byte {
+	codec, err := goavro.NewCodec(orderSchema)
+	if err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+
+	data := make([]byte, 5)
+	binary.BigEndian.PutUint32(data[1:], uint32(id))
+	data, err = codec.BinaryFromNative(data, map[string]interface{}{"id": orderId, "amount": amount})
+	if err != nil {
+		t.Fatalf("unable to encode order: %v", err)
+	}
+
+	return data
+}
+
+// decodeDocument decodes a JSON object, since the order of the fields of decoded Avro records isn't fixed
+func decodeDocument(t *testing.T, data []byte) map[string]interface{} {
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+
+	return document
+}
+
+func TestAvroDecoderDecodesTheWireFormat(t *testing.T) {
+	decoder, registry, stop := createTestDecoder()
+	defer stop()
+
+	for index := int64(0); index < 5; index++ {
+		decoded, err := decoder.Decode(encodeOrder(t, 1, fmt.Sprintf("order-%d", index), 1000 + index))
+		if err != nil {
+			t.Fatalf("unable to decode: %v", err)
+		}
+
+		expected := map[string]interface{}{"id": fmt.Sprintf("order-%d", index), "amount": float64(1000 + index)}
+		if document := decodeDocument(t, decoded); !reflect.DeepEqual(document, expected) {
+			t.Errorf("expected %v, got %s", expected, decoded)
+		}
+	}
+
+	if requests := registry.getRequests(1); requests != 1 {
+		t.Errorf("expected the schema to be retrieved once, got %d requests", requests)
+	}
+}
+
+func TestAvroDecoderRejectsInvalidData(t *testing.T) {
+	decoder, registry, stop := createTestDecoder()
+	defer stop()
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{name: "unknown schema", data: encodeOrder(t, 9, "order", 1), expected: "unable to retrieve schema 9: 404"},
+		{name: "unknown schema again", data: encodeOrder(t, 9, "order", 1), expected: "unable to retrieve schema 9: 404"},
+		{name: "protobuf schema", data: encodeOrder(t, 2, "order", 1), expected: "schema 2 is a PROTOBUF schema"},
+		{name: "missing magic byte", data: []byte(`{"id": "order"}`), expected: "not serialized with the schema registry wire format"},
+		{name: "truncated data", data: encodeOrder(t, 1, "order", 1)[:7], expected: "unable to decode Avro data with schema 1"},
+	}
+
+	for _, test := range tests {
+		_, err := decoder.Decode(test.data)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+
+	if requests := registry.getRequests(9); requests != 1 {
+		t.Errorf("expected the unknown schema to be requested once, got %d requests", requests)
+	}
+}
+
+func TestAvroDecoderRetriesServerErrors(t *testing.T) {
+	decoder, registry, stop := createTestDecoder()
+	defer stop()
+
+	data := encodeOrder(t, 3, "order", 1200)
+	if _, err := decoder.Decode(data); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("expected a server error, got %v", err)
+	}
+
+	decoded, err := decoder.Decode(data)
+	if err != nil {
+		t.Fatalf("unable to decode after retrying: %v", err)
+	}
+
+	expected := map[string]interface{}{"id": "order", "amount": float64(1200)}
+	if !reflect.DeepEqual(decodeDocument(t, decoded), expected) || registry.getRequests(3) != 2 {
+		t.Errorf("expected the order after 2 requests, got %s after %d", decoded, registry.getRequests(3))
+	}
+}
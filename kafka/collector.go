@@ -0,0 +1,134 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// collector collects matched messages in the order they are matched. The messages are kept in memory
+// until the spill threshold has been reached, after which the remaining messages are spilled to a
+// temporary file. A threshold of zero keeps all messages in memory
+type collector struct {
+	messages  *list.List
+	threshold int64
+	path      string
+	file      *os.File
+	writer    *bufio.Writer
+	encoder   *gob.Encoder
+	spilled   int64
+}
+
+func createCollector(threshold int64) *collector {
+	return &collector{messages: list.New(), threshold: threshold}
+}
+
+func (collector *collector) add(message *Message) error {
+	if collector.threshold <= 0 || int64(collector.messages.Len()) < collector.threshold {
+		collector.messages.PushBack(message)
+		return nil
+	}
+
+	if collector.file == nil {
+		file, err := ioutil.TempFile("", "raccoon-*.spill")
+		if err != nil {
+			return err
+		}
+
+		collector.path = file.Name()
+		collector.file = file
+		collector.writer = bufio.NewWriter(file)
+		collector.encoder = gob.NewEncoder(collector.writer)
+	}
+
+	collector.spilled++
+	return collector.encoder.Encode(message)
+}
+
+// finish flushes and closes the spill file, after which no more messages can be added
+func (collector *collector) finish() error {
+	if collector.file == nil {
+		return nil
+	}
+
+	err := collector.writer.Flush()
+	if closeErr := collector.file.Close(); err == nil {
+		err = closeErr
+	}
+	collector.file = nil
+	return err
+}
+
+func (collector *collector) len() int64 {
+	return int64(collector.messages.Len()) + collector.spilled
+}
+
+func (collector *collector) each(handler func(message *Message) error) error {
+	for element := collector.messages.Front(); element != nil; element = element.Next() {
+		if err := handler(element.Value.(*Message)); err != nil {
+			return err
+		}
+	}
+
+	if collector.path == "" {
+		return nil
+	}
+
+	file, err := os.Open(collector.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(file))
+	for {
+		var message Message
+		err := decoder.Decode(&message)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := handler(&message); err != nil {
+			return err
+		}
+	}
+}
+
+func (collector *collector) remove() error {
+	if collector.path == "" {
+		return nil
+	}
+
+	err := os.Remove(collector.path)
+	collector.path = ""
+	return err
+}
@@ -0,0 +1,235 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"strings"
+	"time"
+)
+
+var securityProtocols = []string{"PLAINTEXT", "SSL", "SASL_PLAINTEXT", "SASL_SSL"}
+var saslMechanisms = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512", "OAUTHBEARER"}
+
+// Connection contains the settings used to connect and authenticate to a Kafka cluster
+type Connection struct {
+	BootstrapServer        string
+	SecurityProtocol       string
+	SaslMechanism          string
+	SaslUsername           string
+	SaslPassword           string
+	OAuthBearerToken       string
+	SslCALocation          string
+	SslCertificateLocation string
+	SslKeyLocation         string
+	SslKeyPassword         string
+	SslVerifyHostname      string
+	Properties             map[string]string
+}
+
+// reservedProperties are managed by raccoon and can't be overridden
+var reservedProperties = map[string]string{
+	"group.id":             "use the group flag instead",
+	"enable.auto.commit":   "raccoon never commits offsets",
+	"auto.offset.reset":    "use the earliest, latest or seek flags instead",
+	"enable.partition.eof": "raccoon relies on partition end events to stop reading",
+}
+
+// SetProperty sets a connection setting by its librdkafka property name. Properties without a
+// dedicated setting are passed through to librdkafka as is
+func (connection *Connection) SetProperty(key string, value string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return fmt.Errorf("property name can't be empty")
+	}
+
+	if reason, ok := reservedProperties[key]; ok {
+		return fmt.Errorf("property %q can't be set: %s", key, reason)
+	}
+
+	switch key {
+	case "bootstrap.servers":
+		connection.BootstrapServer = value
+	case "security.protocol":
+		connection.SecurityProtocol = value
+	case "sasl.mechanism", "sasl.mechanisms":
+		connection.SaslMechanism = value
+	case "sasl.username":
+		connection.SaslUsername = value
+	case "sasl.password":
+		connection.SaslPassword = value
+	case "ssl.ca.location":
+		connection.SslCALocation = value
+	case "ssl.certificate.location":
+		connection.SslCertificateLocation = value
+	case "ssl.key.location":
+		connection.SslKeyLocation = value
+	case "ssl.key.password":
+		connection.SslKeyPassword = value
+	case "ssl.endpoint.identification.algorithm":
+		connection.SslVerifyHostname = value
+	default:
+		if connection.Properties == nil {
+			connection.Properties = make(map[string]string)
+		}
+		connection.Properties[key] = value
+	}
+
+	return nil
+}
+
+// Validate verifies that a bootstrap server is provided and that the security protocol,
+// SASL mechanism and credentials are consistent
+func (connection *Connection) Validate() error {
+	if connection.BootstrapServer == "" {
+		return fmt.Errorf("bootstrap server is required")
+	}
+
+	protocol := strings.ToUpper(connection.SecurityProtocol)
+	if protocol != "" && !contains(securityProtocols, protocol) {
+		return fmt.Errorf("invalid security protocol %q. Expected one of %s", connection.SecurityProtocol,
+			strings.Join(securityProtocols, ", "))
+	}
+
+	mechanism := strings.ToUpper(connection.SaslMechanism)
+	if mechanism != "" && !contains(saslMechanisms, mechanism) {
+		return fmt.Errorf("invalid SASL mechanism %q. Expected one of %s", connection.SaslMechanism,
+			strings.Join(saslMechanisms, ", "))
+	}
+
+	if mechanism != "" && !strings.HasPrefix(protocol, "SASL_") {
+		return fmt.Errorf("SASL mechanism %s requires the security protocol SASL_PLAINTEXT or SASL_SSL", mechanism)
+	}
+
+	if strings.HasPrefix(protocol, "SASL_") {
+		switch mechanism {
+		case "":
+			return fmt.Errorf("security protocol %s requires a SASL mechanism", protocol)
+		case "OAUTHBEARER":
+			if connection.OAuthBearerToken == "" {
+				return fmt.Errorf("SASL mechanism OAUTHBEARER requires an OAuth bearer token")
+			}
+		default:
+			if connection.SaslUsername == "" || connection.SaslPassword == "" {
+				return fmt.Errorf("SASL mechanism %s requires a username and password", mechanism)
+			}
+		}
+	}
+
+	if (connection.SslCertificateLocation == "") != (connection.SslKeyLocation == "") {
+		return fmt.Errorf("SSL client authentication requires both a certificate and a key")
+	}
+
+	switch connection.SslVerifyHostname {
+	case "", "https", "none":
+	default:
+		return fmt.Errorf("invalid SSL endpoint identification algorithm %q. Expected https or none",
+			connection.SslVerifyHostname)
+	}
+
+	return nil
+}
+
+func (connection *Connection) apply(configMap kafka.ConfigMap) {
+	configMap["bootstrap.servers"] = connection.BootstrapServer
+
+	protocol := strings.ToUpper(connection.SecurityProtocol)
+	setIfNotEmpty(configMap, "security.protocol", protocol)
+	setIfNotEmpty(configMap, "sasl.mechanism", strings.ToUpper(connection.SaslMechanism))
+	setIfNotEmpty(configMap, "sasl.username", connection.SaslUsername)
+	setIfNotEmpty(configMap, "sasl.password", connection.SaslPassword)
+	setIfNotEmpty(configMap, "ssl.ca.location", connection.SslCALocation)
+	setIfNotEmpty(configMap, "ssl.certificate.location", connection.SslCertificateLocation)
+	setIfNotEmpty(configMap, "ssl.key.location", connection.SslKeyLocation)
+	setIfNotEmpty(configMap, "ssl.key.password", connection.SslKeyPassword)
+
+	if connection.SslVerifyHostname != "" {
+		configMap["ssl.endpoint.identification.algorithm"] = connection.SslVerifyHostname
+	} else if strings.HasSuffix(protocol, "SSL") {
+		// Verify the broker hostname by default when TLS is used
+		configMap["ssl.endpoint.identification.algorithm"] = "https"
+	}
+
+	for key, value := range connection.Properties {
+		configMap[key] = value
+	}
+}
+
+// oauthBearerToken creates a token from the configured bearer token. The expiration time
+// and principal are read from the JWT claims when available
+func (connection *Connection) oauthBearerToken() kafka.OAuthBearerToken {
+	token := kafka.OAuthBearerToken{
+		TokenValue: connection.OAuthBearerToken,
+		Expiration: time.Now().Add(time.Hour),
+		Principal:  connection.SaslUsername,
+	}
+
+	parts := strings.Split(connection.OAuthBearerToken, ".")
+	if len(parts) != 3 {
+		return token
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return token
+	}
+
+	var claims struct {
+		Subject    string `json:"sub"`
+		Expiration int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return token
+	}
+
+	if claims.Expiration > 0 {
+		token.Expiration = time.Unix(claims.Expiration, 0)
+	}
+
+	if token.Principal == "" {
+		token.Principal = claims.Subject
+	}
+
+	return token
+}
+
+func setIfNotEmpty(configMap kafka.ConfigMap, key string, value string) {
+	if value != "" {
+		configMap[key] = value
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -25,101 +25,182 @@
 package kafka
 
 import (
-	"github.com/jedib0t/go-pretty/v6/progress"
-	"github.com/karldahlgren/raccoon/utility"
+	"fmt"
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
 	"math/rand"
+	"regexp"
+	"sort"
 	"strconv"
 	"time"
 )
 
-// CreateEarliestConsumer Creates a new Kafka consumer with the earliest offset
-func CreateEarliestConsumer(bootstrap string, topic string, group string, tracker *progress.Tracker) *kafka.Consumer {
-	return createConsumer(bootstrap, topic, group, "earliest", tracker)
+// Consumer contains the calls raccoon makes to a Kafka consumer. It's implemented by the confluent
+// Kafka consumer, and by the in-memory consumer of the kafkatest package which is used in tests
+type Consumer interface {
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	Poll(timeoutMs int) kafka.Event
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+	OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error)
+	SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error
+	Assign(partitions []kafka.TopicPartition) error
+	Seek(partition kafka.TopicPartition, timeoutMs int) error
+	Close() error
 }
 
-// CreateLatestConsumer Creates a new Kafka consumer with the latest offset
-func CreateLatestConsumer(bootstrap string, topic string, group string, tracker *progress.Tracker) *kafka.Consumer {
-	return createConsumer(bootstrap, topic, group, "latest", tracker)
+// CreateEarliestConsumer Creates a new Kafka consumer with the earliest offset. An error is returned
+// if the consumer configuration is rejected
+func CreateEarliestConsumer(connection Connection, group string) (Consumer, error) {
+	return newConsumer(connection, group, "earliest")
 }
 
-// StopConsumer will stop and disconnect a consumer from Kafka
-func StopConsumer(consumer *kafka.Consumer, tracker *progress.Tracker) {
-	err := consumer.Close()
+// CreateLatestConsumer Creates a new Kafka consumer with the latest offset. An error is returned
+// if the consumer configuration is rejected
+func CreateLatestConsumer(connection Connection, group string) (Consumer, error) {
+	return newConsumer(connection, group, "latest")
+}
+
+// CreateEarliestConsumers Creates a number of Kafka consumers with the earliest offset. An error is returned
+// if the consumer configuration is rejected, in which case all created consumers are closed
+func CreateEarliestConsumers(connection Connection, group string, count int) ([]Consumer, error) {
+	var consumers []Consumer
+	for len(consumers) < count {
+		consumer, err := newConsumer(connection, group, "earliest")
+		if err != nil {
+			_ = StopConsumers(consumers)
+			return nil, err
+		}
+
+		consumers = append(consumers, consumer)
+	}
+
+	return consumers, nil
+}
 
-	if err != nil {
-		tracker.MarkAsDone()
-		utility.ExitOnError(err)
+// StopConsumers will stop and disconnect all consumers from Kafka. The first error is returned
+// after all consumers have been stopped
+func StopConsumers(consumers []Consumer) error {
+	var err error
+	for _, consumer := range consumers {
+		if closeErr := StopConsumer(consumer); err == nil {
+			err = closeErr
+		}
 	}
-	tracker.MarkAsDone()
+
+	return err
+}
+
+// StopConsumer will stop and disconnect a consumer from Kafka
+func StopConsumer(consumer Consumer) error {
+	return consumer.Close()
 }
 
-// GetPartitions retrieves information regarding all partitions for a provided topic
-func GetPartitions(consumer *kafka.Consumer, topic string, tracker *progress.Tracker) map[int32]Partition {
-	metaData, err := consumer.GetMetadata(&topic, false, -1)
+// ResolveTopics returns the provided topics and all topics matching the topic pattern in sorted order.
+// The pattern must match the whole topic name
+func ResolveTopics(consumer Consumer, topics []string, topicPattern string) ([]string, error) {
+	subscribed := make(map[string]bool)
+	for _, topic := range topics {
+		subscribed[topic] = true
+	}
+
+	if topicPattern != "" {
+		pattern, err := regexp.Compile("^(?:" + topicPattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic pattern: %v", err)
+		}
+
+		metaData, err := consumer.GetMetadata(nil, true, -1)
+		if err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		tracker.MarkAsDone()
-		utility.ExitOnError(err)
+		for topic := range metaData.Topics {
+			if pattern.MatchString(topic) {
+				subscribed[topic] = true
+			}
+		}
 	}
 
-	topicMetaData := metaData.Topics[topic]
+	if len(subscribed) == 0 {
+		if topicPattern != "" {
+			return nil, fmt.Errorf("no topics match the topic pattern %s", topicPattern)
+		}
+		return nil, fmt.Errorf("no topics provided")
+	}
 
-	if &topicMetaData == nil {
-		tracker.MarkAsDone()
-		utility.ExitOnError(err)
+	var resolvedTopics []string
+	for topic := range subscribed {
+		resolvedTopics = append(resolvedTopics, topic)
 	}
+	sort.Strings(resolvedTopics)
+
+	return resolvedTopics, nil
+}
 
-	// Set the tracker length to limit + 1 since we otherwise get
-	// invalid formatting for the tracker
-	tracker.Total = int64(len(topicMetaData.Partitions)) + 1
-	partitions := make(map[int32]Partition)
-	for index, partition := range topicMetaData.Partitions {
-		lowOffset, highOffset, err := consumer.QueryWatermarkOffsets(topic, partition.ID, -1)
+// Subscribe subscribes a consumer to the provided topics
+func Subscribe(consumer Consumer, topics []string) error {
+	return consumer.SubscribeTopics(topics, nil)
+}
 
+// GetPartitions retrieves information regarding all partitions for the provided topics
+func GetPartitions(consumer Consumer, topics []string) (map[PartitionID]Partition, error) {
+	partitions := make(map[PartitionID]Partition)
+	for _, topic := range topics {
+		metaData, err := consumer.GetMetadata(&topic, false, -1)
 		if err != nil {
-			tracker.MarkAsDone()
-			utility.ExitOnError(err)
+			return nil, err
 		}
 
-		partitions[partition.ID] = Partition {
-			id: partition.ID,
-			lowOffset: lowOffset,
-			highOffset: highOffset,
+		topicMetaData, ok := metaData.Topics[topic]
+		if !ok {
+			return nil, fmt.Errorf("topic %s not found", topic)
+		} else if topicMetaData.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("topic %s: %v", topic, topicMetaData.Error)
+		}
+
+		for _, partition := range topicMetaData.Partitions {
+			lowOffset, highOffset, err := consumer.QueryWatermarkOffsets(topic, partition.ID, -1)
+			if err != nil {
+				return nil, err
+			}
+
+			partitions[PartitionID{Topic: topic, Partition: partition.ID}] = Partition {
+				topic: topic,
+				id: partition.ID,
+				lowOffset: lowOffset,
+				highOffset: highOffset,
+			}
 		}
-		tracker.Message = "Reading topic partition metadata (" + strconv.Itoa(index + 1) + " partitions)"
-		tracker.Increment(1)
 	}
-	// Sleep for the progress to catch up
-	time.Sleep(100 * time.Millisecond)
-	tracker.MarkAsDone()
-	return partitions
+
+	return partitions, nil
 }
 
-func createConsumer(bootstrap string, topic string, group string, offset string, tracker *progress.Tracker) (*kafka.Consumer) {
+func newConsumer(connection Connection, group string, offset string) (Consumer, error) {
 	if group == "" {
 		group = "raccoon-" + strconv.Itoa(rand.Int())
 	}
-	consumer, consumerError := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers":  bootstrap,
+	configMap := kafka.ConfigMap{
 		"group.id":           group,
 		"auto.offset.reset":  offset,
 		"enable.auto.commit": "false",
-	})
-	if consumerError != nil {
-		tracker.MarkAsDone()
-		utility.ExitOnError(consumerError)
+		// Grep stops reading a partition once its end has been reported
+		"enable.partition.eof": "true",
 	}
+	connection.apply(configMap)
 
-	subscribeError := consumer.SubscribeTopics([]string{topic}, nil)
+	consumer, consumerError := kafka.NewConsumer(&configMap)
+	if consumerError != nil {
+		return nil, fmt.Errorf("invalid consumer configuration: %v", consumerError)
+	}
 
-	if subscribeError != nil {
-		tracker.MarkAsDone()
-		utility.ExitOnError(consumerError)
+	if connection.OAuthBearerToken != "" {
+		tokenError := consumer.SetOAuthBearerToken(connection.oauthBearerToken())
+		if tokenError != nil {
+			_ = consumer.Close()
+			return nil, fmt.Errorf("invalid OAuth bearer token: %v", tokenError)
+		}
 	}
 
-	tracker.MarkAsDone()
-	return consumer
+	return consumer, nil
 }
-
-
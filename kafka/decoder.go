@@ -0,0 +1,86 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+// Decoder decodes the serialized key or value of a message into JSON
+type Decoder interface {
+	Decode(data []byte) ([]byte, error)
+}
+
+// Decoders contains the decoders for message keys and values. A nil decoder leaves the data unchanged
+type Decoders struct {
+	Key   Decoder
+	Value Decoder
+}
+
+// DecodeError is returned when the key or value of a message can't be decoded
+type DecodeError struct {
+	err error
+}
+
+func (err *DecodeError) Error() string {
+	return err.err.Error()
+}
+
+// decode returns a copy of the message with a decoded key and value
+func (decoders Decoders) decode(message *kafka.Message) (*kafka.Message, error) {
+	if decoders.Key == nil && decoders.Value == nil {
+		return message, nil
+	}
+
+	decoded := *message
+	var err error
+	if decoders.Key != nil && len(message.Key) > 0 {
+		decoded.Key, err = decoders.Key.Decode(message.Key)
+		if err != nil {
+			return nil, &DecodeError{err: fmt.Errorf("key: %v", err)}
+		}
+	}
+
+	if decoders.Value != nil && len(message.Value) > 0 {
+		decoded.Value, err = decoders.Value.Decode(message.Value)
+		if err != nil {
+			return nil, &DecodeError{err: fmt.Errorf("value: %v", err)}
+		}
+	}
+
+	return &decoded, nil
+}
+
+// parseWireFormat splits data serialized with the Confluent wire format into the schema ID and the payload
+func parseWireFormat(data []byte) (int32, []byte, error) {
+	if len(data) < 5 || data[0] != 0 {
+		return 0, nil, errors.New("data is not serialized with the schema registry wire format")
+	}
+
+	return int32(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
@@ -0,0 +1,522 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"github.com/karldahlgren/raccoon/utility"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expression is a node in a parsed query expression which can be evaluated on a message
+type Expression interface {
+	evaluate(record *record) bool
+}
+
+type andExpression struct {
+	left  Expression
+	right Expression
+}
+
+type orExpression struct {
+	left  Expression
+	right Expression
+}
+
+type notExpression struct {
+	expression Expression
+}
+
+type constantExpression struct {
+	value bool
+}
+
+type condition struct {
+	field    field
+	operator string
+	value    interface{}
+	regex    *regexp.Regexp
+}
+
+type field struct {
+	name   string
+	header string
+	path   []interface{}
+}
+
+type token struct {
+	kind     string
+	text     string
+	position int
+}
+
+type expressionParser struct {
+	tokens []token
+	index  int
+	// now is the time relative timestamps are resolved against
+	now time.Time
+}
+
+var comparisonOperators = []string{"==", "!=", ">=", "<=", ">", "<", "~"}
+
+// ParseExpression parses a query expression into an expression tree. An expression consists of
+// conditions, such as `key contains "42"` or `header.type == "created"`, combined with and, or, not and parentheses
+func ParseExpression(text string) (Expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &expressionParser{tokens: tokens, now: time.Now()}
+	expression, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !parser.done() {
+		next := parser.peek()
+		return nil, fmt.Errorf("unexpected %q at position %d", next.text, next.position)
+	}
+
+	return expression, nil
+}
+
+func (expression *andExpression) evaluate(record *record) bool {
+	return expression.left.evaluate(record) && expression.right.evaluate(record)
+}
+
+func (expression *orExpression) evaluate(record *record) bool {
+	return expression.left.evaluate(record) || expression.right.evaluate(record)
+}
+
+func (expression *notExpression) evaluate(record *record) bool {
+	return !expression.expression.evaluate(record)
+}
+
+func (expression *constantExpression) evaluate(record *record) bool {
+	return expression.value
+}
+
+func (condition *condition) evaluate(record *record) bool {
+	value, found := condition.field.resolve(record)
+	if !found {
+		return false
+	}
+
+	switch condition.operator {
+	case "":
+		return value != ""
+	case "exists":
+		return true
+	case "contains":
+		text, ok := value.(string)
+		return ok && strings.Contains(strings.ToLower(text), condition.value.(string))
+	case "~":
+		text, ok := value.(string)
+		return ok && condition.regex.MatchString(text)
+	default:
+		return compareValues(value, condition.operator, condition.value)
+	}
+}
+
+func (field field) resolve(record *record) (interface{}, bool) {
+	message := record.message
+	switch field.name {
+	case "key":
+		return string(message.Key), true
+	case "value":
+		return string(message.Value), true
+	case "topic":
+		if message.TopicPartition.Topic == nil {
+			return nil, false
+		}
+		return *message.TopicPartition.Topic, true
+	case "partition":
+		return float64(message.TopicPartition.Partition), true
+	case "offset":
+		return float64(message.TopicPartition.Offset), true
+	case "timestamp":
+		return float64(message.Timestamp.UnixNano() / int64(time.Millisecond)), true
+	case "header":
+		for _, header := range message.Headers {
+			if header.Key == field.header {
+				return string(header.Value), true
+			}
+		}
+		return nil, false
+	default:
+		document, ok := record.json()
+		if !ok {
+			return nil, false
+		}
+		return lookupPath(document, field.path)
+	}
+}
+
+func (parser *expressionParser) parseOr() (Expression, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.acceptKeyword("or") {
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpression{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (parser *expressionParser) parseAnd() (Expression, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.acceptKeyword("and") {
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpression{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (parser *expressionParser) parseNot() (Expression, error) {
+	if parser.acceptKeyword("not") {
+		expression, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpression{expression: expression}, nil
+	}
+
+	return parser.parsePrimary()
+}
+
+func (parser *expressionParser) parsePrimary() (Expression, error) {
+	if parser.done() {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	next := parser.next()
+	if next.kind == "(" {
+		expression, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if parser.done() || parser.peek().kind != ")" {
+			return nil, fmt.Errorf("missing ) for ( at position %d", next.position)
+		}
+		parser.next()
+		return expression, nil
+	}
+
+	if next.kind != "identifier" || isKeyword(next.text) {
+		return nil, fmt.Errorf("expected a field at position %d, found %q", next.position, next.text)
+	}
+
+	selectedField, err := parseField(next)
+	if err != nil {
+		return nil, err
+	}
+
+	condition := &condition{field: selectedField}
+	if parser.done() || !isConditionOperator(parser.peek()) {
+		return condition, nil
+	}
+
+	operator := parser.next()
+	condition.operator = strings.ToLower(operator.text)
+	if parser.done() {
+		return nil, fmt.Errorf("missing value after %s at position %d", operator.text, operator.position)
+	}
+
+	literal := parser.next()
+	if err := condition.setValue(literal, parser.now); err != nil {
+		return nil, err
+	}
+
+	return condition, nil
+}
+
+func (condition *condition) setValue(literal token, now time.Time) error {
+	var value interface{}
+	switch literal.kind {
+	case "string":
+		value = literal.text
+	case "number":
+		number, err := strconv.ParseFloat(literal.text, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q at position %d", literal.text, literal.position)
+		}
+		value = number
+	case "identifier":
+		switch strings.ToLower(literal.text) {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = literal.text
+		}
+	default:
+		return fmt.Errorf("expected a value at position %d, found %q", literal.position, literal.text)
+	}
+
+	switch condition.operator {
+	case "contains":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("contains requires a string value at position %d", literal.position)
+		}
+		condition.value = strings.ToLower(text)
+		return nil
+	case "~":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("~ requires a regular expression string at position %d", literal.position)
+		}
+		regex, err := regexp.Compile(text)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression at position %d: %v", literal.position, err)
+		}
+		condition.regex = regex
+		return nil
+	}
+
+	switch condition.field.name {
+	case "partition", "offset":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s requires a numeric value at position %d", condition.field.name, literal.position)
+		}
+	case "timestamp":
+		switch timestamp := value.(type) {
+		case float64:
+		case string:
+			parsed, err := utility.ParseTime(timestamp, now)
+			if err != nil {
+				return fmt.Errorf("timestamp requires epoch milliseconds or a time at position %d: %v",
+					literal.position, err)
+			}
+			value = float64(parsed.UnixNano() / int64(time.Millisecond))
+		default:
+			return fmt.Errorf("timestamp requires epoch milliseconds or a time at position %d", literal.position)
+		}
+	}
+
+	condition.value = value
+	return nil
+}
+
+func parseField(identifier token) (field, error) {
+	text := identifier.text
+	if strings.HasPrefix(text, "$") {
+		path, remainder, err := parsePath(text)
+		if err != nil || remainder != "" {
+			return field{}, fmt.Errorf("invalid JSON path %q at position %d", text, identifier.position)
+		}
+		return field{name: "json", path: path}, nil
+	}
+
+	lower := strings.ToLower(text)
+	switch lower {
+	case "key", "value", "topic", "partition", "offset", "timestamp":
+		return field{name: lower}, nil
+	}
+
+	if strings.HasPrefix(lower, "header.") && len(text) > len("header.") {
+		return field{name: "header", header: text[len("header."):]}, nil
+	}
+
+	if strings.HasPrefix(lower, "header[") && strings.HasSuffix(text, "]") {
+		name, err := strconv.Unquote(text[len("header[") : len(text)-1])
+		if err == nil {
+			return field{name: "header", header: name}, nil
+		}
+	}
+
+	return field{}, fmt.Errorf("unknown field %q at position %d. Expected key, value, topic, partition, "+
+		"offset, timestamp, header.<name> or a JSON path such as $.id", text, identifier.position)
+}
+
+func isConditionOperator(next token) bool {
+	return next.kind == "operator" || (next.kind == "identifier" && strings.ToLower(next.text) == "contains")
+}
+
+func isKeyword(text string) bool {
+	switch strings.ToLower(text) {
+	case "and", "or", "not", "contains":
+		return true
+	}
+
+	return false
+}
+
+func (parser *expressionParser) acceptKeyword(keyword string) bool {
+	if parser.done() {
+		return false
+	}
+
+	next := parser.peek()
+	if next.kind == "identifier" && strings.ToLower(next.text) == keyword {
+		parser.index++
+		return true
+	}
+
+	return false
+}
+
+func (parser *expressionParser) done() bool {
+	return parser.index >= len(parser.tokens)
+}
+
+func (parser *expressionParser) peek() token {
+	return parser.tokens[parser.index]
+}
+
+func (parser *expressionParser) next() token {
+	next := parser.tokens[parser.index]
+	parser.index++
+	return next
+}
+
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	index := 0
+	for index < len(text) {
+		character := rune(text[index])
+		switch {
+		case unicode.IsSpace(character):
+			index++
+		case character == '(' || character == ')':
+			tokens = append(tokens, token{kind: string(character), text: string(character), position: index})
+			index++
+		case character == '"' || character == '\'':
+			end := index + 1
+			for end < len(text) && text[end] != byte(character) {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+
+			if end >= len(text) {
+				return nil, fmt.Errorf("unterminated string at position %d", index)
+			}
+
+			value, err := unquote(text[index : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %v", index, err)
+			}
+
+			tokens = append(tokens, token{kind: "string", text: value, position: index})
+			index = end + 1
+		case character == '-' || (character >= '0' && character <= '9'):
+			end := index + 1
+			for end < len(text) && (text[end] == '.' || (text[end] >= '0' && text[end] <= '9')) {
+				end++
+			}
+			tokens = append(tokens, token{kind: "number", text: text[index:end], position: index})
+			index = end
+		case strings.ContainsRune("=!<>~", character):
+			operator := ""
+			for _, candidate := range comparisonOperators {
+				if strings.HasPrefix(text[index:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+
+			if operator == "" {
+				return nil, fmt.Errorf("unknown operator at position %d", index)
+			}
+
+			tokens = append(tokens, token{kind: "operator", text: operator, position: index})
+			index += len(operator)
+		case character == '$' || character == '_' || unicode.IsLetter(character):
+			end := index
+			for end < len(text) {
+				if text[end] == '[' {
+					closing := strings.IndexByte(text[end:], ']')
+					if closing == -1 {
+						return nil, fmt.Errorf("missing ] for [ at position %d", end)
+					}
+					end += closing + 1
+				} else if text[end] == '$' || text[end] == '.' || isFieldCharacter(text[end]) {
+					end++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, token{kind: "identifier", text: text[index:end], position: index})
+			index = end
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", character, index)
+		}
+	}
+
+	return tokens, nil
+}
+
+// unquote unquotes a single or double quoted string. Both quote characters can be escaped in either kind of string
+func unquote(text string) (string, error) {
+	quote := text[0]
+	remaining := text[1 : len(text)-1]
+	var builder strings.Builder
+	for len(remaining) > 0 {
+		if len(remaining) > 1 && remaining[0] == '\\' && (remaining[1] == '"' || remaining[1] == '\'') {
+			builder.WriteByte(remaining[1])
+			remaining = remaining[2:]
+			continue
+		}
+
+		value, multibyte, tail, err := strconv.UnquoteChar(remaining, quote)
+		if err != nil {
+			return "", err
+		}
+
+		if multibyte {
+			builder.WriteRune(value)
+		} else {
+			builder.WriteByte(byte(value))
+		}
+		remaining = tail
+	}
+
+	return builder.String(), nil
+}
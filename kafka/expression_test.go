@@ -0,0 +1,127 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+package kafka
+
+import (
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createTestRecord creates a record of a message with a JSON value and a header
+func createTestRecord() *record {
+	topic := "orders"
+	return &record{message: &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 100},
+		Key:            []byte("42"),
+		Value:          []byte(`{"amount": 1200, "customer": "Alice", "note": "a\"b", "quote": "it's", "items": [1, 2]}`),
+		Headers:        []kafka.Header{{Key: "type", Value: []byte("created")}},
+		Timestamp:      time.Date(2021, 1, 1, 14, 0, 0, 0, time.UTC),
+	}}
+}
+
+func TestExpressionEvaluation(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   bool
+	}{
+		{name: "and binds tighter than or", expression: `key == "42" or key == "1" and header.type == "deleted"`, expected: true},
+		{name: "parentheses group or", expression: `(key == "42" or key == "1") and header.type == "deleted"`, expected: false},
+		{name: "not binds to the condition", expression: `not key == "42" and header.type == "deleted"`, expected: false},
+		{name: "not applies to parentheses", expression: `not (key == "42" and header.type == "deleted")`, expected: true},
+		{name: "double not", expression: `not not key == "42"`, expected: true},
+		{name: "keywords are case-insensitive", expression: `key == "1" OR NOT key == "1"`, expected: true},
+		{name: "or is left associative", expression: `key == "1" or key == "2" or key == "42"`, expected: true},
+		{name: "contains is case-insensitive", expression: `value contains "ALICE"`, expected: true},
+		{name: "contains on a header", expression: `header.type contains "reat"`, expected: true},
+		{name: "contains on a JSON string", expression: `$.customer contains "lic"`, expected: true},
+		{name: "contains on a JSON number", expression: `$.amount contains "12"`, expected: false},
+		{name: "contains on a missing header", expression: `header.trace contains ""`, expected: false},
+		{name: "regex on the key", expression: `key ~ "^4[0-9]$"`, expected: true},
+		{name: "regex is case-sensitive", expression: `$.customer ~ "^a"`, expected: false},
+		{name: "regex on a JSON number", expression: `$.amount ~ "1200"`, expected: false},
+		{name: "single-quoted string", expression: `$.customer == 'Alice'`, expected: true},
+		{name: "escaped double quote in single quotes", expression: `$.note == 'a\"b'`, expected: true},
+		{name: "escaped double quote in double quotes", expression: `$.note == "a\"b"`, expected: true},
+		{name: "escaped single quote in single quotes", expression: `$.quote == 'it\'s'`, expected: true},
+		{name: "unicode escape", expression: `$.customer == "\u0041lice"`, expected: true},
+		{name: "header existence", expression: `header.type and not header.trace`, expected: true},
+		{name: "numeric comparison", expression: `$.amount > 1000 and partition == 2 and offset < 101`, expected: true},
+		{name: "timestamp comparison", expression: `timestamp >= "2021-01-01T14:00:00Z"`, expected: true},
+		{name: "timestamp with a UTC offset", expression: `timestamp < "2021-01-01 14:30 +0100"`, expected: false},
+		{name: "timestamp in epoch milliseconds", expression: `timestamp == 1609509600000`, expected: true},
+		{name: "relative timestamp", expression: `timestamp > "-2h"`, expected: false},
+		{name: "timestamp keyword", expression: `timestamp < "today"`, expected: true},
+		{name: "array index", expression: `$.items[1] == 2`, expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := ParseExpression(test.expression)
+			if err != nil {
+				t.Fatalf("unable to parse %s: %v", test.expression, err)
+			}
+
+			if matched := expression.evaluate(createTestRecord()); matched != test.expected {
+				t.Errorf("expected %s to evaluate to %t", test.expression, test.expected)
+			}
+		})
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{expression: `key ==`, expected: "missing value after == at position 4"},
+		{expression: `key == "42" and`, expected: "unexpected end of expression"},
+		{expression: `(key == "42"`, expected: "missing ) for ( at position 0"},
+		{expression: `key == "42")`, expected: `unexpected ")" at position 11`},
+		{expression: `key == "42" key == "1"`, expected: `unexpected "key" at position 12`},
+		{expression: `and key == "42"`, expected: `expected a field at position 0, found "and"`},
+		{expression: `key == "42" or size == 1`, expected: `unknown field "size" at position 15`},
+		{expression: `key == "42`, expected: "unterminated string at position 7"},
+		{expression: `key == "\q"`, expected: "invalid string at position 7"},
+		{expression: `key ~ "("`, expected: "invalid regular expression at position 6"},
+		{expression: `key contains 42`, expected: "contains requires a string value at position 13"},
+		{expression: `partition == "2"`, expected: "partition requires a numeric value at position 13"},
+		{expression: `timestamp > "tomorrow"`, expected: "timestamp requires epoch milliseconds or a time at position 12"},
+		{expression: `timestamp > true`, expected: "timestamp requires epoch milliseconds or a time at position 12"},
+		{expression: `key # "42"`, expected: "unexpected character '#' at position 4"},
+		{expression: `key =! "42"`, expected: "unknown operator at position 4"},
+		{expression: `$.items[0 == 1`, expected: "missing ] for [ at position 7"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseExpression(test.expression)
+		if err == nil {
+			t.Errorf("expected %s to be rejected", test.expression)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("expected %s to be rejected with %q, got %q", test.expression, test.expected, err)
+		}
+	}
+}
@@ -25,113 +25,478 @@
 package kafka
 
 import (
-	"container/list"
-	"github.com/jedib0t/go-pretty/v6/progress"
-	"github.com/karldahlgren/raccoon/utility"
+	"context"
+	"fmt"
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
-	"strconv"
+	"math"
+	"sort"
+	"sync"
 	"time"
 )
 
-// Consume messages from a Kafka consumer
-func Consume(consumer *kafka.Consumer, partitions map[int32]Partition, topic string, keyQuery string, valueQuery string,
-	limit int64, seekTimestamp string, latest bool, tracker *progress.Tracker) Result {
-	if seekTimestamp != "" {
-		partitions = seekToTimestamp(consumer, partitions, topic, seekTimestamp)
-	} else if latest {
-		partitions = seekToLatest(consumer, partitions, topic, limit)
+// readTimeout is how long a read waits for a message before checking whether reading has been stopped
+const readTimeout = 100 * time.Millisecond
+
+// ConsumeOptions configures the reading of partitions
+type ConsumeOptions struct {
+	// Query selects the messages to match. Every message is matched if it's nil
+	Query *Query
+	// Decoders decode the keys and values of the messages before they are matched
+	Decoders Decoders
+	// Limit is the maximum number of messages read per partition. 0 is no limit
+	Limit int64
+	// From is the time to start reading at, unless it's zero
+	From time.Time
+	// To is the time to stop reading each partition at, unless it's zero
+	To time.Time
+	// Latest starts reading at the high offset minus the limit of each partition
+	Latest bool
+	// Workers is the number of consumers reading and of workers matching messages in parallel. 0 is one worker
+	Workers int
+	// MaxMatches stops reading once a number of messages have been matched. 0 is no limit
+	MaxMatches int64
+	// SpillThreshold is the number of matched messages kept in memory before the remaining are
+	// spilled to a temporary file. 0 is never
+	SpillThreshold int64
+	// IdleTimeout stops a consumer once it hasn't read anything for a duration. 0 is no timeout
+	IdleTimeout time.Duration
+	// Handler is called with each matched message instead of collecting it in the result, unless it's nil
+	Handler MessageHandler
+	// Progress is called with the number of read messages, unless it's nil
+	Progress ProgressFunc
+}
+
+// CatchUpOptions configures the reading of the messages published before a tail
+type CatchUpOptions struct {
+	// Query selects the messages to match. Every message is matched if it's nil
+	Query *Query
+	// Decoders decode the keys and values of the messages before they are matched
+	Decoders Decoders
+	// From is the time to start reading at, unless it's zero
+	From time.Time
+	// Earliest starts reading at the low offset of each partition
+	Earliest bool
+	// LatestMinus starts reading at the high offset minus a number of messages of each partition
+	LatestMinus int64
+	// SpillThreshold is the number of matched messages kept in memory before the remaining are
+	// spilled to a temporary file. 0 is never
+	SpillThreshold int64
+	// IdleTimeout stops reading once nothing has been read for a duration. 0 is no timeout
+	IdleTimeout time.Duration
+	// Handler is called with each matched message instead of collecting it in the result, unless it's nil
+	Handler MessageHandler
+	// Progress is called with the number of read messages, unless it's nil
+	Progress ProgressFunc
+}
+
+// Consume messages from Kafka consumers. Matched messages are collected in the result, unless a handler
+// is provided, in which case each matched message is passed to the handler instead. The partitions are
+// assigned to the consumers with explicit start offsets, and are distributed evenly between them, while
+// messages are matched by a number of workers. The result contains the start offset of each partition,
+// and the messages read before an error occurred. Reading stops early once the context is cancelled
+func Consume(ctx context.Context, consumers []Consumer, partitions map[PartitionID]Partition,
+	options ConsumeOptions) (Result, error) {
+	limit := options.Limit
+	if limit == 0 {
+		limit = math.MaxInt64
+	}
+
+	var err error
+	if !options.From.IsZero() {
+		partitions, err = startAtTimestamp(consumers[0], partitions, options.From)
+		if err != nil {
+			return Result{}, err
+		}
+	} else if options.Latest {
+		partitions = startAtLatest(partitions, limit)
+	}
+
+	if !options.To.IsZero() {
+		partitions, err = limitToTimestamp(consumers[0], partitions, options.To)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	partitionsByConsumer := []map[PartitionID]Partition{partitions}
+	if len(consumers) > 1 {
+		partitionsByConsumer = splitPartitions(partitions, len(consumers))
 	}
 
-	// List of messages
-	messages := list.New()
+	for index, consumer := range consumers {
+		if err := assignPartitions(consumer, partitionsByConsumer[index]); err != nil {
+			return Result{}, err
+		}
+	}
 
-	// Calculate the limit for each partition
-	limitByPartition := getMessageLimitByPartition(partitions, limit)
+	result, err := consume(ctx, consumers, partitionsByConsumer, options.Query, options.Decoders, limit,
+		options.Workers, options.MaxMatches, options.SpillThreshold, options.IdleTimeout, options.Handler,
+		options.Progress)
+	result.StartOffsets = getStartOffsets(partitions)
+	return result, err
+}
 
-	// Initialize a counter for each partition
-	counterByPartition := getCounterByPartition(partitions)
+// CatchUp assigns the partitions to the consumer and reads all messages from a start position up to the high
+// offset of each partition. The consumer is left positioned at the high offsets, so that messages published
+// while catching up are read by a following tail
+func CatchUp(ctx context.Context, consumer Consumer, partitions map[PartitionID]Partition,
+	options CatchUpOptions) (Result, error) {
+	var err error
+	startPartitions := partitions
+	if !options.From.IsZero() {
+		startPartitions, err = startAtTimestamp(consumer, partitions, options.From)
+		if err != nil {
+			return Result{}, err
+		}
+	} else if !options.Earliest {
+		startPartitions = startAtLatest(partitions, options.LatestMinus)
+	}
 
-	// Set the tracker length to limit + 1 since we otherwise get
-	// invalid formatting for the tracker
-	tracker.Total = utility.Sum(limitByPartition) + 1
+	if err := assignPartitions(consumer, startPartitions); err != nil {
+		return Result{}, err
+	}
 
-	matchedMessages := int64(0)
+	result, err := consume(ctx, []Consumer{consumer}, []map[PartitionID]Partition{startPartitions}, options.Query,
+		options.Decoders, math.MaxInt64, 1, 0, options.SpillThreshold, options.IdleTimeout, options.Handler,
+		options.Progress)
+	result.StartOffsets = getStartOffsets(startPartitions)
+	if err != nil {
+		return result, err
+	}
 
+	// Messages published to a partition after it has caught up are skipped while
+	// other partitions catch up, so they are reread from the high offset
+	endPartitions := make(map[PartitionID]Partition)
+	for id, partition := range partitions {
+		partition.lowOffset = partition.highOffset
+		endPartitions[id] = partition
+	}
+
+	return result, assignPartitions(consumer, endPartitions)
+}
+
+// parsedMessage is the outcome of matching a message on a worker
+type parsedMessage struct {
+	message *Message
+	err     error
+}
+
+// consume reads the partitions of each consumer on a separate goroutine, and matches the read messages
+// on a number of worker goroutines. The outcomes are collected on the calling goroutine, which is the
+// only one updating the counters, and calling the handler and the progress function. Reading stops early
+// once maxMatches messages have been matched, unless maxMatches is zero, once the context is cancelled,
+// once reading fails, or once a consumer hasn't read anything within the idle timeout, unless it's zero
+func consume(ctx context.Context, consumers []Consumer, partitionsByConsumer []map[PartitionID]Partition,
+	query *Query, decoders Decoders, limit int64, workers int, maxMatches int64, spillThreshold int64,
+	idleTimeout time.Duration, handler MessageHandler, progress ProgressFunc) (Result, error) {
 	startTime := time.Now()
-	for {
-		if isLimitReached(limitByPartition, counterByPartition) {
-			break
+
+	// Matched messages
+	messages := createCollector(spillThreshold)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	records := make(chan *kafka.Message, 100 * workers)
+	outcomes := make(chan parsedMessage, 100 * workers)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopReading := func() {
+		stopOnce.Do(func() {
+			close(stop)
+		})
+	}
+
+	// The first read error stops all readers
+	var readErr error
+	var readErrOnce sync.Once
+	failReading := func(err error) {
+		readErrOnce.Do(func() {
+			readErr = err
+		})
+		stopReading()
+	}
+
+	// Readers stopped by the idle timeout only stop reading their own partitions
+	idleTimedOut := false
+	var idleOnce sync.Once
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopReading()
+		case <-finished:
 		}
+	}()
 
-		msg, err := consumer.ReadMessage(-1)
+	total := int64(0)
+	var readers sync.WaitGroup
+	for index, consumer := range consumers {
+		// Calculate the limit for each partition
+		limitByPartition := getMessageLimitByPartition(partitionsByConsumer[index], limit)
+		total += sum(limitByPartition)
 
-		if err != nil {
-			tracker.MarkAsDone()
-			utility.ExitOnError(err)
+		readers.Add(1)
+		go func(consumer Consumer, partitions map[PartitionID]Partition, limitByPartition map[PartitionID]int64) {
+			defer readers.Done()
+			idle, err := readPartitions(consumer, partitions, limitByPartition, idleTimeout, records, stop)
+			if err != nil {
+				failReading(err)
+			} else if idle {
+				idleOnce.Do(func() {
+					idleTimedOut = true
+				})
+			}
+		}(consumer, partitionsByConsumer[index], limitByPartition)
+	}
+
+	var matchers sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		matchers.Add(1)
+		go func() {
+			defer matchers.Done()
+			for record := range records {
+				message, err := parseMessage(record, query, decoders)
+				select {
+				case outcomes <- parsedMessage{message: message, err: err}:
+				case <-stop:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		readers.Wait()
+		close(records)
+		matchers.Wait()
+		close(outcomes)
+	}()
+
+	matchedMessages := int64(0)
+	readMessages := int64(0)
+	invalidMessages := int64(0)
+	undecodableMessages := int64(0)
+	stopped := false
+	var collectErr error
+
+	if progress != nil {
+		progress(0, total, 0)
+	}
+
+	for outcome := range outcomes {
+		if stopped || ctx.Err() != nil {
+			// Messages read before the readers stopped are discarded
+			continue
 		}
 
-		partitionId := msg.TopicPartition.Partition
-		if counterByPartition[partitionId] < limitByPartition[partitionId] {
-			message := parseMessage(msg, keyQuery, valueQuery)
-			if message != nil {
-				matchedMessages++
-				tracker.Message = "Reading messages (" + strconv.FormatInt(matchedMessages, 10) + " matches)"
-				messages.PushFront(message)
+		readMessages++
+		if _, ok := outcome.err.(*DecodeError); ok {
+			undecodableMessages++
+		} else if outcome.err != nil {
+			invalidMessages++
+		} else if outcome.message != nil {
+			matchedMessages++
+			if handler != nil {
+				handler(outcome.message)
+			} else if err := messages.add(outcome.message); err != nil {
+				collectErr = err
+				stopped = true
+				stopReading()
 			}
 
-			counterByPartition[partitionId] = counterByPartition[partitionId] + 1
-			tracker.Increment(1)
+			if maxMatches > 0 && matchedMessages >= maxMatches {
+				stopped = true
+				stopReading()
+			}
 		}
 
+		if progress != nil {
+			progress(readMessages, total, matchedMessages)
+		}
 	}
 	stopTime := time.Now()
 	elapsedTime := stopTime.Sub(startTime)
 
-	// Sleep for the progress to catch up
-	time.Sleep(100 * time.Millisecond)
+	if err := messages.finish(); err != nil && collectErr == nil {
+		collectErr = err
+	}
 
-	readMessage := utility.Sum(counterByPartition)
-	tracker.MarkAsDone()
-	return Result{
-		Messages: *messages,
+	result := Result{
 		MatchedMessages:    matchedMessages,
-		ReadMessages: readMessage,
+		InvalidMessages: invalidMessages,
+		UndecodableMessages: undecodableMessages,
+		ReadMessages: readMessages,
 		Duration: elapsedTime,
+		IdleTimedOut: idleTimedOut,
+		Interrupted: ctx.Err() != nil,
+		collectors: []*collector{messages},
+	}
+
+	if readErr != nil {
+		return result, readErr
+	} else if collectErr != nil {
+		return result, fmt.Errorf("unable to collect matched messages: %v", collectErr)
 	}
+
+	return result, nil
 }
 
+// readPartitions reads messages from a consumer until every partition is done, or until reading is stopped.
+// A partition is done once its limit has been reached, once its high offset has been reached, or once the
+// end of the partition has been reported, since compacted messages, aborted messages and transaction markers
+// are never read as messages. Done partitions are unassigned. Reading stops early and true is returned if
+// nothing has been read within the idle timeout, unless it's zero
+func readPartitions(consumer Consumer, partitions map[PartitionID]Partition, limitByPartition map[PartitionID]int64,
+	idleTimeout time.Duration, records chan<- *kafka.Message, stop <-chan struct{}) (bool, error) {
+	counterByPartition := make(map[PartitionID]int64)
+	positions := make(map[PartitionID]int64)
+	remaining := make(map[PartitionID]bool)
+	for id, partition := range partitions {
+		positions[id] = partition.lowOffset
+		if limitByPartition[id] > 0 && partition.lowOffset < partition.highOffset {
+			remaining[id] = true
+		}
+	}
+
+	assigned := len(partitions)
+	lastEventTime := time.Now()
+	for {
+		if len(remaining) < assigned {
+			// Finished partitions are unassigned, so that they are no longer fetched
+			if err := assignRemaining(consumer, partitions, remaining, positions); err != nil {
+				return false, err
+			}
+			assigned = len(remaining)
+		}
+
+		if len(remaining) == 0 {
+			return false, nil
+		}
 
-func isLimitReached(limitByPartition map[int32]int64, counterByPartition map[int32]int64) bool {
-	for id, limit := range limitByPartition {
-		if counterByPartition[id] < limit {
-			return false
+		select {
+		case <-stop:
+			return false, nil
+		default:
 		}
+
+		switch event := consumer.Poll(int(readTimeout / time.Millisecond)).(type) {
+		case *kafka.Message:
+			lastEventTime = time.Now()
+			if event.TopicPartition.Error != nil {
+				return false, event.TopicPartition.Error
+			}
+
+			partitionId := PartitionID{Topic: *event.TopicPartition.Topic, Partition: event.TopicPartition.Partition}
+			offset := int64(event.TopicPartition.Offset)
+			if !remaining[partitionId] {
+				continue
+			} else if offset >= partitions[partitionId].highOffset {
+				// The message is after the end of the partition, such as the end of an offset range
+				delete(remaining, partitionId)
+				continue
+			}
+
+			positions[partitionId] = offset + 1
+			counterByPartition[partitionId]++
+			if counterByPartition[partitionId] >= limitByPartition[partitionId] ||
+				offset + 1 >= partitions[partitionId].highOffset {
+				delete(remaining, partitionId)
+			}
+
+			select {
+			case records <- event:
+			case <-stop:
+				return false, nil
+			}
+		case kafka.PartitionEOF:
+			lastEventTime = time.Now()
+			if event.Topic != nil {
+				delete(remaining, PartitionID{Topic: *event.Topic, Partition: event.Partition})
+			}
+		case kafka.Error:
+			if event.IsFatal() {
+				return false, event
+			}
+			// Other errors, such as lost broker connections, are retried by the consumer
+		}
+
+		if idleTimeout > 0 && time.Since(lastEventTime) >= idleTimeout {
+			return true, nil
+		}
+	}
+}
+
+// assignRemaining assigns the remaining partitions at their current positions. The client can't unassign
+// single partitions, so the assignment is replaced instead
+func assignRemaining(consumer Consumer, partitions map[PartitionID]Partition, remaining map[PartitionID]bool,
+	positions map[PartitionID]int64) error {
+	remainingPartitions := make(map[PartitionID]Partition)
+	for id := range remaining {
+		partition := partitions[id]
+		partition.lowOffset = positions[id]
+		remainingPartitions[id] = partition
 	}
 
-	return true
+	return assignPartitions(consumer, remainingPartitions)
 }
 
-func getMessageLimitByPartition(partitions map[int32]Partition, limit int64) map[int32]int64  {
-	limits := make(map[int32]int64)
+// splitPartitions distributes the partitions evenly into a number of groups
+func splitPartitions(partitions map[PartitionID]Partition, count int) []map[PartitionID]Partition {
+	var ids []PartitionID
+	for id := range partitions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Topic != ids[j].Topic {
+			return ids[i].Topic < ids[j].Topic
+		}
+		return ids[i].Partition < ids[j].Partition
+	})
+
+	groups := make([]map[PartitionID]Partition, count)
+	for index := range groups {
+		groups[index] = make(map[PartitionID]Partition)
+	}
+	for index, id := range ids {
+		groups[index % count][id] = partitions[id]
+	}
+
+	return groups
+}
+
+func getMessageLimitByPartition(partitions map[PartitionID]Partition, limit int64) map[PartitionID]int64  {
+	limits := make(map[PartitionID]int64)
 
 	for _, partition := range partitions {
 		max := partition.highOffset - partition.lowOffset
 		if limit > max {
-			limits[partition.id] = max
+			limits[partition.partitionID()] = max
 		} else {
-			limits[partition.id] = limit
+			limits[partition.partitionID()] = limit
 		}
 	}
 
 	return limits
 }
 
-func getCounterByPartition(partitions map[int32]Partition) map[int32]int64 {
-	counters := make(map[int32]int64)
+// getStartOffsets returns the offset each partition is read from
+func getStartOffsets(partitions map[PartitionID]Partition) map[PartitionID]int64 {
+	offsets := make(map[PartitionID]int64)
+	for id, partition := range partitions {
+		offsets[id] = partition.lowOffset
+	}
 
-	for _, partition := range partitions {
-		counters[partition.id] = 0
+	return offsets
+}
+
+func sum(values map[PartitionID]int64) int64 {
+	total := int64(0)
+	for _, value := range values {
+		total += value
 	}
 
-	return counters
+	return total
 }
@@ -0,0 +1,466 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka/kafkatest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// The in-memory consumer must be usable wherever a Kafka consumer is
+var _ Consumer = (*kafkatest.Consumer)(nil)
+
+// baseTime is the timestamp of the first message of each test partition
+var baseTime = time.Date(2021, 1, 1, 14, 0, 0, 0, time.UTC)
+
+// createTestCluster creates a topic with a number of partitions, each containing a number of messages
+// one minute apart. The value of each message is its partition and offset
+func createTestCluster(topic string, partitions int, messages int) *kafkatest.Cluster {
+	cluster := kafkatest.NewCluster()
+	cluster.CreateTopic(topic, partitions)
+	for partition := 0; partition < partitions; partition++ {
+		for offset := 0; offset < messages; offset++ {
+			cluster.Produce(topic, int32(partition), fmt.Sprintf("key-%d", offset), fmt.Sprintf("value-%d-%d", partition, offset),
+				baseTime.Add(time.Duration(offset) * time.Minute))
+		}
+	}
+
+	return cluster
+}
+
+// getTestPartitions returns the partitions of a topic of the cluster
+func getTestPartitions(t *testing.T, consumer Consumer, topic string) map[PartitionID]Partition {
+	partitions, err := GetPartitions(consumer, []string{topic})
+	if err != nil {
+		t.Fatalf("unable to get partitions: %v", err)
+	}
+
+	return partitions
+}
+
+// getOffsets returns the offsets of the collected messages of each partition in sorted order
+func getOffsets(t *testing.T, result Result) map[int32][]int64 {
+	offsets := make(map[int32][]int64)
+	err := result.Each(func(message *Message) error {
+		offsets[message.Partition] = append(offsets[message.Partition], message.Offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to iterate the result: %v", err)
+	}
+
+	for _, partitionOffsets := range offsets {
+		sort.Slice(partitionOffsets, func(i, j int) bool {
+			return partitionOffsets[i] < partitionOffsets[j]
+		})
+	}
+
+	return offsets
+}
+
+// offsetsBetween returns the offsets from start up to, but not including, end
+func offsetsBetween(start int64, end int64) []int64 {
+	var offsets []int64
+	for offset := start; offset < end; offset++ {
+		offsets = append(offsets, offset)
+	}
+
+	return offsets
+}
+
+// testConsume consumes the partitions of the topic with a consumer
+func testConsume(t *testing.T, cluster *kafkatest.Cluster, options ConsumeOptions) Result {
+	consumer := cluster.NewConsumer("earliest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	result, err := Consume(context.Background(), []Consumer{consumer}, partitions, options)
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+
+	return result
+}
+
+func TestConsumeLimitsEachPartition(t *testing.T) {
+	cluster := createTestCluster("orders", 3, 10)
+
+	result := testConsume(t, cluster, ConsumeOptions{Limit: 4})
+	defer result.Close()
+
+	if result.ReadMessages != 12 || result.MatchedMessages != 12 {
+		t.Errorf("expected 12 read and matched messages, got %d read and %d matched", result.ReadMessages, result.MatchedMessages)
+	}
+
+	expected := map[int32][]int64{0: offsetsBetween(0, 4), 1: offsetsBetween(0, 4), 2: offsetsBetween(0, 4)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeReadsToTheEndWithoutLimit(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+
+	result := testConsume(t, cluster, ConsumeOptions{})
+	defer result.Close()
+
+	if result.ReadMessages != 20 {
+		t.Errorf("expected 20 read messages, got %d", result.ReadMessages)
+	}
+}
+
+func TestConsumeReadsNothingFromEmptyTopic(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 0)
+
+	result := testConsume(t, cluster, ConsumeOptions{Limit: 1000})
+	defer result.Close()
+
+	if result.ReadMessages != 0 {
+		t.Errorf("expected no read messages, got %d", result.ReadMessages)
+	}
+}
+
+func TestConsumeOnlyCollectsMatchedMessages(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	query, err := CreateQuery("", "value-1-", nil, false, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create query: %v", err)
+	}
+
+	result := testConsume(t, cluster, ConsumeOptions{Query: query, Limit: 1000})
+	defer result.Close()
+
+	if result.ReadMessages != 20 || result.MatchedMessages != 10 {
+		t.Errorf("expected 20 read and 10 matched messages, got %d read and %d matched", result.ReadMessages, result.MatchedMessages)
+	}
+
+	expected := map[int32][]int64{1: offsetsBetween(0, 10)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeLatestReadsTheLastMessagesOfEachPartition(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+
+	result := testConsume(t, cluster, ConsumeOptions{Limit: 3, Latest: true})
+	defer result.Close()
+
+	expected := map[int32][]int64{0: offsetsBetween(7, 10), 1: offsetsBetween(7, 10)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeLatestReadsShortPartitionsInFull(t *testing.T) {
+	cluster := createTestCluster("orders", 1, 2)
+
+	result := testConsume(t, cluster, ConsumeOptions{Limit: 5, Latest: true})
+	defer result.Close()
+
+	expected := map[int32][]int64{0: offsetsBetween(0, 2)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeSeekStartsAtTheTime(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+
+	result := testConsume(t, cluster, ConsumeOptions{From: baseTime.Add(6 * time.Minute)})
+	defer result.Close()
+
+	expected := map[int32][]int64{0: offsetsBetween(6, 10), 1: offsetsBetween(6, 10)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeSeekAfterTheLastMessageReadsNothing(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+
+	result := testConsume(t, cluster, ConsumeOptions{From: baseTime.Add(time.Hour)})
+	defer result.Close()
+
+	if result.ReadMessages != 0 {
+		t.Errorf("expected no read messages, got %d", result.ReadMessages)
+	}
+}
+
+func TestConsumeTimeWindowIncludesBothEnds(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+
+	result := testConsume(t, cluster, ConsumeOptions{
+		From: baseTime.Add(2 * time.Minute),
+		To:   baseTime.Add(4 * time.Minute),
+	})
+	defer result.Close()
+
+	expected := map[int32][]int64{0: offsetsBetween(2, 5), 1: offsetsBetween(2, 5)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeWithWorkersReadsEachMessageOnce(t *testing.T) {
+	cluster := createTestCluster("orders", 5, 20)
+	consumers := []Consumer{cluster.NewConsumer("earliest"), cluster.NewConsumer("earliest"), cluster.NewConsumer("earliest")}
+	defer StopConsumers(consumers)
+
+	partitions := getTestPartitions(t, consumers[0], "orders")
+	result, err := Consume(context.Background(), consumers, partitions, ConsumeOptions{Limit: 15, Workers: 4})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer result.Close()
+
+	expected := make(map[int32][]int64)
+	for partition := int32(0); partition < 5; partition++ {
+		expected[partition] = offsetsBetween(0, 15)
+	}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeStopsAtMaxMatches(t *testing.T) {
+	cluster := createTestCluster("orders", 3, 100)
+	consumer := cluster.NewConsumer("earliest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	result, err := Consume(context.Background(), []Consumer{consumer}, partitions, ConsumeOptions{
+		Workers:    2,
+		MaxMatches: 7,
+	})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer result.Close()
+
+	if result.MatchedMessages != 7 || result.CollectedMessages() != 7 {
+		t.Errorf("expected 7 matched messages, got %d matched and %d collected", result.MatchedMessages,
+			result.CollectedMessages())
+	}
+}
+
+func TestConsumeStopsWhenCancelled(t *testing.T) {
+	cluster := createTestCluster("orders", 1, 10)
+	consumer := cluster.NewConsumer("earliest")
+	consumer.DisablePartitionEOF()
+	defer consumer.Close()
+
+	// The end of the partition is never reached, so only the cancellation stops reading
+	partitions := getTestPartitions(t, consumer, "orders")
+	cluster.Compact("orders", 0, 9)
+	ctx, cancel := context.WithTimeout(context.Background(), 200 * time.Millisecond)
+	defer cancel()
+
+	type outcome struct {
+		result Result
+		err    error
+	}
+	outcomes := make(chan outcome, 1)
+	startTime := time.Now()
+	go func() {
+		result, err := Consume(ctx, []Consumer{consumer}, partitions, ConsumeOptions{Limit: 1000})
+		outcomes <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case outcome := <-outcomes:
+		defer outcome.result.Close()
+		if outcome.err != nil {
+			t.Fatalf("unable to consume: %v", outcome.err)
+		}
+
+		if elapsed := time.Since(startTime); elapsed > 2 * time.Second {
+			t.Errorf("expected reading to stop shortly after the cancellation, took %v", elapsed)
+		}
+		if !outcome.result.Interrupted || outcome.result.ReadMessages > 9 {
+			t.Errorf("expected an interrupted result with at most 9 read messages, got %t and %d",
+				outcome.result.Interrupted, outcome.result.ReadMessages)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected reading to stop once the context was cancelled")
+	}
+}
+
+func TestConsumeUnassignsFinishedPartitions(t *testing.T) {
+	cluster := createTestCluster("orders", 3, 10)
+	consumer := cluster.NewConsumer("earliest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	result, err := Consume(context.Background(), []Consumer{consumer}, partitions, ConsumeOptions{Limit: 4})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer result.Close()
+
+	// The messages after the limit are no longer fetched
+	if event := consumer.Poll(0); event != nil {
+		t.Errorf("expected no assigned partitions, got %v", event)
+	}
+}
+
+func TestConsumeSpillsMatchedMessagesInOrder(t *testing.T) {
+	cluster := createTestCluster("orders", 1, 50)
+
+	consumer := cluster.NewConsumer("earliest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	result, err := Consume(context.Background(), []Consumer{consumer}, partitions, ConsumeOptions{SpillThreshold: 10})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer result.Close()
+
+	var offsets []int64
+	_ = result.Each(func(message *Message) error {
+		offsets = append(offsets, message.Offset)
+		return nil
+	})
+	if !reflect.DeepEqual(offsets, offsetsBetween(0, 50)) {
+		t.Errorf("expected offsets 0 to 49 in order, got %v", offsets)
+	}
+}
+
+func TestConsumeReportsTheStartOffsetOfEachPartition(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	cluster.Produce("orders", 1, "key", "value", baseTime.Add(time.Hour))
+
+	result := testConsume(t, cluster, ConsumeOptions{Limit: 3, Latest: true})
+	defer result.Close()
+
+	expected := map[PartitionID]int64{{Topic: "orders", Partition: 0}: 7, {Topic: "orders", Partition: 1}: 8}
+	if !reflect.DeepEqual(result.StartOffsets, expected) {
+		t.Errorf("expected start offsets %v, got %v", expected, result.StartOffsets)
+	}
+}
+
+func TestConsumeStartsAtTheTimeRegardlessOfTheOffsetReset(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	consumer := cluster.NewConsumer("latest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	result, err := Consume(context.Background(), []Consumer{consumer}, partitions, ConsumeOptions{
+		From: baseTime.Add(5 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer result.Close()
+
+	expected := map[int32][]int64{0: offsetsBetween(5, 10), 1: offsetsBetween(5, 10)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeDoesNotWaitForCompactedMessages(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	cluster.Compact("orders", 0, 2, 3, 8, 9)
+	cluster.Compact("orders", 1, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+
+	result := testConsume(t, cluster, ConsumeOptions{Limit: 1000})
+	defer result.Close()
+
+	expected := map[int32][]int64{0: {0, 1, 4, 5, 6, 7}}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeDoesNotWaitForTransactionMarkers(t *testing.T) {
+	cluster := createTestCluster("orders", 1, 5)
+	cluster.CommitTransaction("orders", 0)
+
+	result := testConsume(t, cluster, ConsumeOptions{Limit: 1000})
+	defer result.Close()
+
+	if result.ReadMessages != 5 || result.IdleTimedOut || result.Interrupted {
+		t.Errorf("expected 5 read messages without timing out, got %d", result.ReadMessages)
+	}
+}
+
+func TestConsumeStopsAtTheEndOfAnOffsetRangeAfterCompaction(t *testing.T) {
+	cluster := createTestCluster("orders", 1, 10)
+	cluster.Compact("orders", 0, 5)
+
+	consumer := cluster.NewConsumer("earliest")
+	consumer.DisablePartitionEOF()
+	defer consumer.Close()
+
+	// The last offset of the range has been compacted, so the range ends at the next message
+	assignment, err := CreateAssignment(nil, []string{"0:2-5"})
+	if err != nil {
+		t.Fatalf("unable to create assignment: %v", err)
+	}
+	partitions, err := assignment.Select(getTestPartitions(t, consumer, "orders"))
+	if err != nil {
+		t.Fatalf("unable to select partitions: %v", err)
+	}
+
+	result, err := Consume(context.Background(), []Consumer{consumer}, partitions, ConsumeOptions{})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer result.Close()
+
+	expected := map[int32][]int64{0: {2, 3, 4}}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestConsumeStopsAfterTheIdleTimeout(t *testing.T) {
+	cluster := createTestCluster("orders", 1, 10)
+	cluster.Compact("orders", 0, 9)
+
+	consumer := cluster.NewConsumer("earliest")
+	consumer.DisablePartitionEOF()
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	result, err := Consume(context.Background(), []Consumer{consumer}, partitions, ConsumeOptions{
+		IdleTimeout: 300 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer result.Close()
+
+	if result.ReadMessages != 9 || !result.IdleTimedOut {
+		t.Errorf("expected 9 read messages and an idle timeout, got %d and %t", result.ReadMessages, result.IdleTimedOut)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+// Package kafkatest provides an in-memory Kafka cluster with consumers, which can replace a Kafka
+// broker when testing code that reads messages through the raccoon kafka package
+package kafkatest
+
+import (
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cluster is an in-memory Kafka cluster. It's safe for concurrent use
+type Cluster struct {
+	mutex  sync.Mutex
+	topics map[string][]*partition
+}
+
+// partition contains the messages of a partition ordered by offset
+type partition struct {
+	messages   []*kafka.Message
+	lowOffset  int64
+	highOffset int64
+}
+
+// NewCluster creates an empty cluster
+func NewCluster() *Cluster {
+	return &Cluster{topics: make(map[string][]*partition)}
+}
+
+// CreateTopic creates a topic with a number of empty partitions
+func (cluster *Cluster) CreateTopic(topic string, partitions int) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+
+	cluster.topics[topic] = make([]*partition, partitions)
+	for index := range cluster.topics[topic] {
+		cluster.topics[topic][index] = &partition{}
+	}
+}
+
+// Produce appends a message to a partition of a topic, which must exist, and returns its offset
+func (cluster *Cluster) Produce(topic string, partitionID int32, key string, value string, timestamp time.Time,
+	headers ...kafka.Header) int64 {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+
+	partition := cluster.topics[topic][partitionID]
+	offset := partition.highOffset
+	partition.messages = append(partition.messages, &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partitionID, Offset: kafka.Offset(offset)},
+		Key:            []byte(key),
+		Value:          []byte(value),
+		Headers:        headers,
+		Timestamp:      timestamp,
+		TimestampType:  kafka.TimestampCreateTime,
+	})
+	partition.highOffset++
+
+	return offset
+}
+
+// Compact removes messages from a partition of a topic, which must exist, like log compaction or aborted
+// transactions do. The offsets of the remaining messages are kept
+func (cluster *Cluster) Compact(topic string, partitionID int32, offsets ...int64) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+
+	removed := make(map[int64]bool)
+	for _, offset := range offsets {
+		removed[offset] = true
+	}
+
+	partition := cluster.topics[topic][partitionID]
+	var messages []*kafka.Message
+	for _, message := range partition.messages {
+		if !removed[int64(message.TopicPartition.Offset)] {
+			messages = append(messages, message)
+		}
+	}
+	partition.messages = messages
+}
+
+// CommitTransaction appends a transaction marker to a partition of a topic, which must exist. The marker
+// takes up an offset, but is never read as a message
+func (cluster *Cluster) CommitTransaction(topic string, partitionID int32) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+
+	cluster.topics[topic][partitionID].highOffset++
+}
+
+// NewConsumer creates a consumer of the cluster. The offset reset is either earliest or latest, and
+// decides where the partitions of a subscription are read from
+func (cluster *Cluster) NewConsumer(offsetReset string) *Consumer {
+	return &Consumer{
+		cluster:     cluster,
+		offsetReset: offsetReset,
+		positions:   make(map[partitionKey]int64),
+		reachedEnd:  make(map[partitionKey]bool),
+	}
+}
+
+// getPartition returns a partition, or nil if it doesn't exist. The mutex must be held
+func (cluster *Cluster) getPartition(topic string, partitionID int32) *partition {
+	partitions, ok := cluster.topics[topic]
+	if !ok || partitionID < 0 || int(partitionID) >= len(partitions) {
+		return nil
+	}
+
+	return partitions[partitionID]
+}
+
+// getTopics returns the names of all topics in sorted order. The mutex must be held
+func (cluster *Cluster) getTopics() []string {
+	var topics []string
+	for topic := range cluster.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	return topics
+}
+
+// next returns the first message of the partition at or after the offset, or nil if there is none.
+// The mutex must be held
+func (partition *partition) next(offset int64) *kafka.Message {
+	index := sort.Search(len(partition.messages), func(index int) bool {
+		return int64(partition.messages[index].TopicPartition.Offset) >= offset
+	})
+	if index == len(partition.messages) {
+		return nil
+	}
+
+	return partition.messages[index]
+}
@@ -0,0 +1,332 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafkatest
+
+import (
+	"fmt"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pollInterval is how often a read checks for new messages while waiting
+const pollInterval = time.Millisecond
+
+// partitionKey identifies a partition of a topic
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// Consumer is an in-memory consumer of a Cluster. It implements the calls raccoon makes to a Kafka consumer
+type Consumer struct {
+	cluster     *Cluster
+	offsetReset string
+
+	mutex      sync.Mutex
+	subscribed []string
+	assigned   bool
+	positions  map[partitionKey]int64
+	reachedEnd map[partitionKey]bool
+	noEOF      bool
+	turn       int
+	closed     bool
+}
+
+// DisablePartitionEOF stops the consumer from reporting the end of partitions, like a Kafka consumer
+// without enable.partition.eof
+func (consumer *Consumer) DisablePartitionEOF() {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+
+	consumer.noEOF = true
+}
+
+// ReadMessage returns the next message of the assigned partitions, which are read in turns. Other events are
+// discarded. A timed out error is returned if no message is available within the timeout, unless the timeout
+// is negative
+func (consumer *Consumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		switch event := consumer.next().(type) {
+		case *kafka.Message:
+			return event, nil
+		case kafka.Error:
+			return nil, event
+		case nil:
+			if timeout >= 0 && !time.Now().Before(deadline) {
+				return nil, kafka.NewError(kafka.ErrTimedOut, "Local: Timed out", false)
+			}
+			time.Sleep(pollInterval)
+		}
+	}
+}
+
+// Poll returns the next event, which is either a message, the end of a partition or an error. The end of a
+// partition is reported once each time it's reached. Nil is returned if there is no event within the timeout,
+// unless the timeout is negative
+func (consumer *Consumer) Poll(timeoutMs int) kafka.Event {
+	deadline := time.Now().Add(time.Duration(timeoutMs) * time.Millisecond)
+	for {
+		if event := consumer.next(); event != nil {
+			return event
+		} else if timeoutMs >= 0 && !time.Now().Before(deadline) {
+			return nil
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// next returns the next available event, or nil if there is none
+func (consumer *Consumer) next() kafka.Event {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+	consumer.cluster.mutex.Lock()
+	defer consumer.cluster.mutex.Unlock()
+
+	if consumer.closed {
+		return kafka.NewError(kafka.ErrState, "Consumer closed", true)
+	}
+
+	if !consumer.assigned && len(consumer.subscribed) > 0 {
+		// The partitions of a subscription are assigned once reading starts
+		for _, topic := range consumer.subscribed {
+			for id := range consumer.cluster.topics[topic] {
+				consumer.resetPosition(partitionKey{topic: topic, partition: int32(id)}, kafka.OffsetStored)
+			}
+		}
+		consumer.assigned = true
+	}
+
+	keys := consumer.getAssignedKeys()
+	for count := 0; count < len(keys); count++ {
+		key := keys[(consumer.turn + count) % len(keys)]
+		partition := consumer.cluster.getPartition(key.topic, key.partition)
+		if partition == nil {
+			continue
+		}
+
+		if message := partition.next(consumer.positions[key]); message != nil {
+			consumer.turn = (consumer.turn + count + 1) % len(keys)
+			consumer.positions[key] = int64(message.TopicPartition.Offset) + 1
+			consumer.reachedEnd[key] = false
+			return copyMessage(message)
+		} else if !consumer.reachedEnd[key] && !consumer.noEOF {
+			// Removed messages and transaction markers at the end of the partition are skipped
+			consumer.turn = (consumer.turn + count + 1) % len(keys)
+			consumer.positions[key] = partition.highOffset
+			consumer.reachedEnd[key] = true
+			topic := key.topic
+			return kafka.PartitionEOF{Topic: &topic, Partition: key.partition, Offset: kafka.Offset(partition.highOffset)}
+		}
+	}
+
+	return nil
+}
+
+// GetMetadata returns the partitions of a topic, or of all topics if allTopics is true
+func (consumer *Consumer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	consumer.cluster.mutex.Lock()
+	defer consumer.cluster.mutex.Unlock()
+
+	var topics []string
+	if allTopics {
+		topics = consumer.cluster.getTopics()
+	} else if topic != nil {
+		topics = []string{*topic}
+	}
+
+	metadata := &kafka.Metadata{Topics: make(map[string]kafka.TopicMetadata)}
+	for _, name := range topics {
+		topicMetadata := kafka.TopicMetadata{Topic: name}
+		partitions, ok := consumer.cluster.topics[name]
+		if !ok {
+			topicMetadata.Error = kafka.NewError(kafka.ErrUnknownTopicOrPart, "Broker: Unknown topic or partition", false)
+		}
+		for id := range partitions {
+			topicMetadata.Partitions = append(topicMetadata.Partitions, kafka.PartitionMetadata{ID: int32(id)})
+		}
+
+		metadata.Topics[name] = topicMetadata
+	}
+
+	return metadata, nil
+}
+
+// QueryWatermarkOffsets returns the low and high offsets of a partition
+func (consumer *Consumer) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error) {
+	consumer.cluster.mutex.Lock()
+	defer consumer.cluster.mutex.Unlock()
+
+	found := consumer.cluster.getPartition(topic, partition)
+	if found == nil {
+		return 0, 0, unknownPartitionError(topic, partition)
+	}
+
+	return found.lowOffset, found.highOffset, nil
+}
+
+// OffsetsForTimes returns the earliest offset of each partition whose timestamp is equal to or later than the
+// timestamp in milliseconds provided as its offset. The end offset is returned if there is no such message
+func (consumer *Consumer) OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error) {
+	consumer.cluster.mutex.Lock()
+	defer consumer.cluster.mutex.Unlock()
+
+	for _, topicPartition := range times {
+		found := consumer.cluster.getPartition(*topicPartition.Topic, topicPartition.Partition)
+		if found == nil {
+			return nil, unknownPartitionError(*topicPartition.Topic, topicPartition.Partition)
+		}
+
+		timestamp := int64(topicPartition.Offset)
+		topicPartition.Offset = kafka.OffsetEnd
+		for _, message := range found.messages {
+			if message.Timestamp.UnixNano() / int64(time.Millisecond) >= timestamp {
+				topicPartition.Offset = message.TopicPartition.Offset
+				break
+			}
+		}
+
+		offsets = append(offsets, topicPartition)
+	}
+
+	return offsets, nil
+}
+
+// SubscribeTopics subscribes to topics. Their partitions are assigned once reading starts
+func (consumer *Consumer) SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+
+	consumer.subscribed = append([]string(nil), topics...)
+	consumer.assigned = false
+	consumer.positions = make(map[partitionKey]int64)
+	consumer.reachedEnd = make(map[partitionKey]bool)
+	return nil
+}
+
+// Assign assigns partitions, replacing the subscription and any previous assignment. Each partition is read
+// from its offset, which can also be a logical offset
+func (consumer *Consumer) Assign(partitions []kafka.TopicPartition) error {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+	consumer.cluster.mutex.Lock()
+	defer consumer.cluster.mutex.Unlock()
+
+	consumer.subscribed = nil
+	consumer.assigned = true
+	consumer.positions = make(map[partitionKey]int64)
+	consumer.reachedEnd = make(map[partitionKey]bool)
+	for _, topicPartition := range partitions {
+		key := partitionKey{topic: *topicPartition.Topic, partition: topicPartition.Partition}
+		if consumer.cluster.getPartition(key.topic, key.partition) == nil {
+			return unknownPartitionError(key.topic, key.partition)
+		}
+
+		consumer.resetPosition(key, topicPartition.Offset)
+	}
+
+	return nil
+}
+
+// Seek sets the offset an assigned partition is read from
+func (consumer *Consumer) Seek(partition kafka.TopicPartition, timeoutMs int) error {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+	consumer.cluster.mutex.Lock()
+	defer consumer.cluster.mutex.Unlock()
+
+	key := partitionKey{topic: *partition.Topic, partition: partition.Partition}
+	if _, ok := consumer.positions[key]; !ok {
+		return kafka.NewError(kafka.ErrState, fmt.Sprintf("Partition %s [%d] isn't assigned", key.topic, key.partition), false)
+	}
+
+	consumer.resetPosition(key, partition.Offset)
+	return nil
+}
+
+// Close closes the consumer. Reading from a closed consumer fails
+func (consumer *Consumer) Close() error {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+
+	consumer.closed = true
+	return nil
+}
+
+// resetPosition sets the position of a partition from an offset, which can also be a logical offset.
+// Both mutexes must be held
+func (consumer *Consumer) resetPosition(key partitionKey, offset kafka.Offset) {
+	partition := consumer.cluster.getPartition(key.topic, key.partition)
+	consumer.reachedEnd[key] = false
+	if offset == kafka.OffsetStored || offset == kafka.OffsetInvalid {
+		// There are no committed offsets, so the offset reset is used
+		if consumer.offsetReset == "latest" {
+			offset = kafka.OffsetEnd
+		} else {
+			offset = kafka.OffsetBeginning
+		}
+	}
+
+	switch offset {
+	case kafka.OffsetBeginning:
+		consumer.positions[key] = partition.lowOffset
+	case kafka.OffsetEnd:
+		consumer.positions[key] = partition.highOffset
+	default:
+		consumer.positions[key] = int64(offset)
+	}
+}
+
+// getAssignedKeys returns the assigned partitions in sorted order. The mutex must be held
+func (consumer *Consumer) getAssignedKeys() []partitionKey {
+	var keys []partitionKey
+	for key := range consumer.positions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].topic != keys[j].topic {
+			return keys[i].topic < keys[j].topic
+		}
+		return keys[i].partition < keys[j].partition
+	})
+
+	return keys
+}
+
+func unknownPartitionError(topic string, partition int32) error {
+	return kafka.NewError(kafka.ErrUnknownTopicOrPart, fmt.Sprintf("Unknown partition %s [%d]", topic, partition), false)
+}
+
+// copyMessage copies a message, so that the stored message isn't shared with the reader
+func copyMessage(message *kafka.Message) *kafka.Message {
+	copied := *message
+	topic := *message.TopicPartition.Topic
+	copied.TopicPartition.Topic = &topic
+	copied.Headers = append([]kafka.Header(nil), message.Headers...)
+	return &copied
+}
@@ -0,0 +1,122 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafkatest
+
+import (
+	"fmt"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Producer is an in-memory producer of a Cluster. It implements the calls raccoon makes to a Kafka producer
+type Producer struct {
+	cluster *Cluster
+
+	mutex   sync.Mutex
+	pending sync.WaitGroup
+	turn    int
+	closed  bool
+}
+
+// NewProducer creates a producer of the cluster
+func (cluster *Cluster) NewProducer() *Producer {
+	return &Producer{cluster: cluster}
+}
+
+// Produce appends a message to the cluster and sends its delivery report to the delivery channel. Messages
+// without a partition are written to a partition picked by the hash of their key, or in turns if they have
+// no key. The delivery report contains an error if the topic or the partition doesn't exist
+func (producer *Producer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	producer.mutex.Lock()
+	defer producer.mutex.Unlock()
+
+	if producer.closed {
+		return kafka.NewError(kafka.ErrState, "Producer closed", true)
+	}
+
+	report := *msg
+	topic := *msg.TopicPartition.Topic
+	report.TopicPartition.Topic = &topic
+	report.TopicPartition.Partition, report.TopicPartition.Error = producer.getPartition(msg)
+	if report.TopicPartition.Error == nil {
+		timestamp := msg.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+
+		report.Timestamp = timestamp
+		report.TopicPartition.Offset = kafka.Offset(producer.cluster.Produce(topic, report.TopicPartition.Partition,
+			string(msg.Key), string(msg.Value), timestamp, msg.Headers...))
+	}
+
+	// Delivery reports are sent asynchronously, like by a Kafka producer
+	producer.pending.Add(1)
+	go func() {
+		defer producer.pending.Done()
+		deliveryChan <- &report
+	}()
+
+	return nil
+}
+
+// Flush waits for the delivery reports of all produced messages, and returns the number of outstanding reports
+func (producer *Producer) Flush(timeoutMs int) int {
+	producer.pending.Wait()
+	return 0
+}
+
+// Close closes the producer. Producing with a closed producer fails
+func (producer *Producer) Close() {
+	producer.mutex.Lock()
+	defer producer.mutex.Unlock()
+
+	producer.closed = true
+}
+
+// getPartition returns the partition a message is written to. The mutex must be held
+func (producer *Producer) getPartition(msg *kafka.Message) (int32, error) {
+	topic := *msg.TopicPartition.Topic
+	producer.cluster.mutex.Lock()
+	partitions := len(producer.cluster.topics[topic])
+	producer.cluster.mutex.Unlock()
+
+	partition := msg.TopicPartition.Partition
+	if partitions == 0 {
+		return partition, kafka.NewError(kafka.ErrUnknownTopicOrPart, fmt.Sprintf("Unknown topic %s", topic), false)
+	} else if partition == kafka.PartitionAny && len(msg.Key) > 0 {
+		hash := fnv.New32a()
+		_, _ = hash.Write(msg.Key)
+		partition = int32(hash.Sum32() % uint32(partitions))
+	} else if partition == kafka.PartitionAny {
+		partition = int32(producer.turn % partitions)
+		producer.turn++
+	} else if partition < 0 || int(partition) >= partitions {
+		return partition, unknownPartitionError(topic, partition)
+	}
+
+	return partition, nil
+}
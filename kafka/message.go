@@ -30,7 +30,22 @@ import "time"
 type Message struct {
 	Key       string
 	Value     string
+	Headers   []Header
 	Timestamp time.Time
+	Topic     string
 	Partition int32
-	Offset    string
+	Offset    int64
 }
+
+// Header is a key/value pair attached to a Kafka message
+type Header struct {
+	Key   string
+	Value string
+}
+
+// MessageHandler is called with each matched message as soon as it has been matched
+type MessageHandler func(message *Message)
+
+// ProgressFunc is called with the number of read messages, the total number of messages to read, or -1 if
+// the total is unknown, and the number of matched messages. It's only called from one goroutine at a time
+type ProgressFunc func(read int64, total int64, matched int64)
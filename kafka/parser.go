@@ -26,22 +26,49 @@ package kafka
 
 import (
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
-	"strings"
 )
 
-func parseMessage(message *kafka.Message, keyQuery string, valueQuery string) *Message  {
-	key := strings.ToLower(string(message.Key))
-	value := strings.ToLower(string(message.Value))
-	if (keyQuery != "" && strings.Contains(key, keyQuery)) ||
-		(valueQuery != "" && strings.Contains(value, valueQuery)) {
-		return &Message{
-			Key:       string(message.Key),
-			Value:     value,
-			Timestamp: message.Timestamp,
-			Partition: message.TopicPartition.Partition,
-			Offset:    message.TopicPartition.Offset.String(),
-		}
+func parseMessage(message *kafka.Message, query *Query, decoders Decoders) (*Message, error)  {
+	message, err := decoders.decode(message)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
\ No newline at end of file
+	matched, err := query.matches(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if matched {
+		return createMessage(message), nil
+	}
+
+	return nil, nil
+}
+
+// createMessage converts a Kafka message
+func createMessage(message *kafka.Message) *Message {
+	topic := ""
+	if message.TopicPartition.Topic != nil {
+		topic = *message.TopicPartition.Topic
+	}
+
+	return &Message{
+		Key:       string(message.Key),
+		Value:     string(message.Value),
+		Headers:   parseHeaders(message.Headers),
+		Timestamp: message.Timestamp,
+		Topic:     topic,
+		Partition: message.TopicPartition.Partition,
+		Offset:    int64(message.TopicPartition.Offset),
+	}
+}
+
+func parseHeaders(headers []kafka.Header) []Header {
+	var parsedHeaders []Header
+	for _, header := range headers {
+		parsedHeaders = append(parsedHeaders, Header{Key: header.Key, Value: string(header.Value)})
+	}
+
+	return parsedHeaders
+}
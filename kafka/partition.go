@@ -24,9 +24,20 @@
 
 package kafka
 
+// PartitionID identifies a partition of a topic
+type PartitionID struct {
+	Topic     string
+	Partition int32
+}
+
 // Partition information about a topic partition
 type Partition struct {
+	topic string
 	id int32
 	highOffset int64
 	lowOffset int64
-}
\ No newline at end of file
+}
+
+func (partition Partition) partitionID() PartitionID {
+	return PartitionID{Topic: partition.topic, Partition: partition.id}
+}
@@ -0,0 +1,235 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var operators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// Predicate is a field level condition, such as `$.customer.id == "42"`, evaluated on a JSON document
+type Predicate struct {
+	path     []interface{}
+	operator string
+	value    interface{}
+}
+
+// CreatePredicate parses a predicate expression. The expression consists of a JSONPath, an operator
+// and a JSON literal. A predicate without an operator and a literal only verifies that the path exists
+func CreatePredicate(expression string) (*Predicate, error) {
+	path, remainder, err := parsePath(strings.TrimSpace(expression))
+	if err != nil {
+		return nil, fmt.Errorf("invalid predicate %q: %v", expression, err)
+	}
+
+	predicate := &Predicate{path: path}
+	remainder = strings.TrimSpace(remainder)
+	if remainder == "" {
+		return predicate, nil
+	}
+
+	for _, operator := range operators {
+		if strings.HasPrefix(remainder, operator) {
+			predicate.operator = operator
+			break
+		}
+	}
+
+	if predicate.operator == "" {
+		return nil, fmt.Errorf("invalid predicate %q: expected one of the operators %s", expression,
+			strings.Join(operators, ", "))
+	}
+
+	literal := strings.TrimSpace(remainder[len(predicate.operator):])
+	if literal == "" {
+		return nil, fmt.Errorf("invalid predicate %q: missing value after %s", expression, predicate.operator)
+	}
+
+	if err := json.Unmarshal([]byte(literal), &predicate.value); err != nil {
+		// Treat unquoted values as strings, e.g. $.status == ACTIVE
+		predicate.value = literal
+	}
+
+	return predicate, nil
+}
+
+// Evaluate the predicate on a decoded JSON document
+func (predicate *Predicate) Evaluate(document interface{}) bool {
+	value, found := lookupPath(document, predicate.path)
+	if !found {
+		return false
+	}
+
+	if predicate.operator == "" {
+		return true
+	}
+
+	return compareValues(value, predicate.operator, predicate.value)
+}
+
+func (predicate *Predicate) evaluate(record *record) bool {
+	document, ok := record.json()
+	return ok && predicate.Evaluate(document)
+}
+
+func parsePath(expression string) ([]interface{}, string, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return nil, "", errors.New("path must start with $")
+	}
+
+	var path []interface{}
+	index := 1
+	for index < len(expression) {
+		switch expression[index] {
+		case '.':
+			start := index + 1
+			index = start
+			for index < len(expression) && isFieldCharacter(expression[index]) {
+				index++
+			}
+
+			if index == start {
+				return nil, "", fmt.Errorf("missing field name at position %d", start)
+			}
+
+			path = append(path, expression[start:index])
+		case '[':
+			end := strings.IndexByte(expression[index:], ']')
+			if end == -1 {
+				return nil, "", fmt.Errorf("missing ] for [ at position %d", index)
+			}
+
+			selector := expression[index+1 : index+end]
+			if unquoted, err := strconv.Unquote(selector); err == nil {
+				path = append(path, unquoted)
+			} else if position, err := strconv.Atoi(selector); err == nil {
+				path = append(path, position)
+			} else {
+				return nil, "", fmt.Errorf("invalid selector [%s]", selector)
+			}
+
+			index += end + 1
+		default:
+			return path, expression[index:], nil
+		}
+	}
+
+	return path, "", nil
+}
+
+func isFieldCharacter(character byte) bool {
+	return character == '_' || character == '-' ||
+		(character >= 'a' && character <= 'z') ||
+		(character >= 'A' && character <= 'Z') ||
+		(character >= '0' && character <= '9')
+}
+
+func lookupPath(document interface{}, path []interface{}) (interface{}, bool) {
+	current := document
+	for _, element := range path {
+		switch selector := element.(type) {
+		case string:
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			current, ok = object[selector]
+			if !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := current.([]interface{})
+			if !ok || selector < 0 || selector >= len(array) {
+				return nil, false
+			}
+
+			current = array[selector]
+		}
+	}
+
+	return current, true
+}
+
+func compareValues(actual interface{}, operator string, expected interface{}) bool {
+	switch operator {
+	case "==":
+		return equalValues(actual, expected)
+	case "!=":
+		return !equalValues(actual, expected)
+	}
+
+	var comparison int
+	switch expectedValue := expected.(type) {
+	case float64:
+		actualValue, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+
+		switch {
+		case actualValue < expectedValue:
+			comparison = -1
+		case actualValue > expectedValue:
+			comparison = 1
+		}
+	case string:
+		actualValue, ok := actual.(string)
+		if !ok {
+			return false
+		}
+
+		comparison = strings.Compare(actualValue, expectedValue)
+	default:
+		return false
+	}
+
+	switch operator {
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	}
+
+	return false
+}
+
+func equalValues(actual interface{}, expected interface{}) bool {
+	switch actual.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+
+	return actual == expected
+}
@@ -0,0 +1,156 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+package kafka
+
+import (
+	"encoding/json"
+	"github.com/karldahlgren/raccoon/kafka/kafkatest"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"strings"
+	"testing"
+)
+
+const testDocument = `{"id": "42", "amount": 1200, "active": true, "deleted": null, "status": "ACTIVE",
+	"first name": "Alice", "customer": {"id": 7}, "items": [{"sku": "A"}, {"sku": "B"}]}`
+
+func TestPredicateEvaluation(t *testing.T) {
+	var document interface{}
+	if err := json.Unmarshal([]byte(testDocument), &document); err != nil {
+		t.Fatalf("invalid test document: %v", err)
+	}
+
+	tests := []struct {
+		predicate string
+		expected  bool
+	}{
+		{predicate: `$.amount == 1200`, expected: true},
+		{predicate: `$.amount == "1200"`, expected: false},
+		{predicate: `$.id == "42"`, expected: true},
+		{predicate: `$.id == 42`, expected: false},
+		{predicate: `$.id > 41`, expected: false},
+		{predicate: `$.amount > 1000`, expected: true},
+		{predicate: `$.amount <= 1199.5`, expected: false},
+		{predicate: `$.amount > "1000"`, expected: false},
+		{predicate: `$.status == ACTIVE`, expected: true},
+		{predicate: `$.status >= "A"`, expected: true},
+		{predicate: `$.active == true`, expected: true},
+		{predicate: `$.active != false`, expected: true},
+		{predicate: `$.customer.id == 7`, expected: true},
+		{predicate: `$.customer == {"id": 7}`, expected: false},
+		{predicate: `$["first name"] == "Alice"`, expected: true},
+		{predicate: `$.items[1].sku == "B"`, expected: true},
+		{predicate: `$.items[0]["sku"] == "A"`, expected: true},
+		{predicate: `$.items[2]`, expected: false},
+		{predicate: `$.items[-1]`, expected: false},
+		{predicate: `$.amount[0]`, expected: false},
+		{predicate: `$.items.sku`, expected: false},
+		{predicate: `$.deleted`, expected: true},
+		{predicate: `$.deleted == null`, expected: true},
+		{predicate: `$.deleted != null`, expected: false},
+		{predicate: `$.missing`, expected: false},
+		{predicate: `$.missing == null`, expected: false},
+		{predicate: `$.missing != null`, expected: false},
+		{predicate: `$.customer.missing.id == 7`, expected: false},
+	}
+
+	for _, test := range tests {
+		predicate, err := CreatePredicate(test.predicate)
+		if err != nil {
+			t.Errorf("unable to create predicate %s: %v", test.predicate, err)
+		} else if matched := predicate.Evaluate(document); matched != test.expected {
+			t.Errorf("expected %s to evaluate to %t", test.predicate, test.expected)
+		}
+	}
+}
+
+func TestInvalidPredicates(t *testing.T) {
+	tests := []struct {
+		predicate string
+		expected  string
+	}{
+		{predicate: `amount > 1000`, expected: "path must start with $"},
+		{predicate: `$. == 1`, expected: "missing field name at position 2"},
+		{predicate: `$.items[0 == 1`, expected: "missing ] for [ at position 7"},
+		{predicate: `$.items[first] == 1`, expected: "invalid selector [first]"},
+		{predicate: `$.amount ~ 1000`, expected: "expected one of the operators"},
+		{predicate: `$.amount >=`, expected: "missing value after >="},
+	}
+
+	for _, test := range tests {
+		_, err := CreatePredicate(test.predicate)
+		if err == nil {
+			t.Errorf("expected %s to be rejected", test.predicate)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("expected %s to be rejected with %q, got %q", test.predicate, test.expected, err)
+		}
+	}
+}
+
+func TestPredicatesOnInvalidJSON(t *testing.T) {
+	query, err := CreateQuery("", "", nil, false, []string{"$.amount > 1000"}, "")
+	if err != nil {
+		t.Fatalf("unable to create query: %v", err)
+	}
+
+	tests := []struct {
+		value    string
+		matched  bool
+		expected error
+	}{
+		{value: `{"amount": 1200}`, matched: true},
+		{value: `{"amount": 800}`, matched: false},
+		{value: `[1200]`, matched: false},
+		{value: `amount=1200`, matched: false, expected: ErrInvalidJSON},
+		{value: ``, matched: false, expected: ErrInvalidJSON},
+	}
+
+	for _, test := range tests {
+		matched, err := query.matches(&kafka.Message{Value: []byte(test.value)})
+		if matched != test.matched || err != test.expected {
+			t.Errorf("expected %q to give %t and %v, got %t and %v", test.value, test.matched, test.expected,
+				matched, err)
+		}
+	}
+}
+
+func TestConsumeCountsInvalidJSONSeparately(t *testing.T) {
+	cluster := kafkatest.NewCluster()
+	cluster.CreateTopic("orders", 1)
+	for _, value := range []string{`{"amount": 1200}`, `{"amount": 800}`, `not json`, `{"amount": 1500}`, `{`} {
+		cluster.Produce("orders", 0, "key", value, baseTime)
+	}
+
+	query, err := CreateQuery("", "", nil, false, []string{"$.amount > 1000"}, "")
+	if err != nil {
+		t.Fatalf("unable to create query: %v", err)
+	}
+
+	result := testConsume(t, cluster, ConsumeOptions{Query: query})
+	defer result.Close()
+
+	if result.ReadMessages != 5 || result.MatchedMessages != 2 || result.InvalidMessages != 2 {
+		t.Errorf("expected 5 read, 2 matched and 2 invalid messages, got %d, %d and %d", result.ReadMessages,
+			result.MatchedMessages, result.InvalidMessages)
+	}
+}
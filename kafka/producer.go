@@ -0,0 +1,187 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"io"
+	"sync"
+	"time"
+)
+
+// AnyPartition lets the producer choose the partition of a message
+const AnyPartition = int32(kafka.PartitionAny)
+
+// Producer contains the calls raccoon makes to a Kafka producer. It's implemented by the confluent
+// Kafka producer, and by the in-memory producer of the kafkatest package which is used in tests
+type Producer interface {
+	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
+	Flush(timeoutMs int) int
+	Close()
+}
+
+// MessageSource returns the next message to produce, or io.EOF once there are no more messages
+type MessageSource func() (*Message, error)
+
+// Delivery is the delivery report of a produced message. The message contains the partition and
+// offset it was written to, unless producing it failed
+type Delivery struct {
+	Index   int64
+	Message *Message
+	Err     error
+}
+
+// DeliveryHandler is called with the delivery report of each produced message. It's only called from
+// one goroutine at a time
+type DeliveryHandler func(delivery Delivery)
+
+// ProduceResult from producing messages
+type ProduceResult struct {
+	ProducedMessages int64
+	FailedMessages   int64
+	Duration         time.Duration
+}
+
+// CreateProducer Creates a new Kafka producer. An error is returned if the producer configuration is rejected
+func CreateProducer(connection Connection) (Producer, error) {
+	configMap := kafka.ConfigMap{}
+	connection.apply(configMap)
+
+	producer, err := kafka.NewProducer(&configMap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid producer configuration: %v", err)
+	}
+
+	if connection.OAuthBearerToken != "" {
+		if err := producer.SetOAuthBearerToken(connection.oauthBearerToken()); err != nil {
+			producer.Close()
+			return nil, fmt.Errorf("invalid OAuth bearer token: %v", err)
+		}
+	}
+
+	return producer, nil
+}
+
+// Produce publishes the messages of the source, and passes the delivery report of each message to the handler
+// in the order they are delivered. Messages are published until the source is exhausted or the context is
+// cancelled, and all published messages are waited for before returning. An error is returned if the source
+// fails, together with the result of the messages published before
+func Produce(ctx context.Context, producer Producer, source MessageSource, handler DeliveryHandler) (ProduceResult, error) {
+	startTime := time.Now()
+	deliveries := make(chan kafka.Event, 100)
+
+	var result ProduceResult
+	var waiting sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range deliveries {
+			report, ok := event.(*kafka.Message)
+			if !ok {
+				continue
+			}
+
+			delivery := Delivery{Index: report.Opaque.(int64), Message: createMessage(report), Err: report.TopicPartition.Error}
+			if delivery.Err != nil {
+				result.FailedMessages++
+			} else {
+				result.ProducedMessages++
+			}
+
+			if handler != nil {
+				handler(delivery)
+			}
+			waiting.Done()
+		}
+	}()
+
+	var sourceErr error
+	for index := int64(0); ctx.Err() == nil; index++ {
+		message, err := source()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			sourceErr = err
+			break
+		}
+
+		waiting.Add(1)
+		kafkaMessage := createKafkaMessage(message, index)
+		err = producer.Produce(kafkaMessage, deliveries)
+		for isQueueFull(err) {
+			// Wait for earlier messages to be delivered before retrying
+			producer.Flush(100)
+			err = producer.Produce(kafkaMessage, deliveries)
+		}
+
+		if err != nil {
+			// The message was rejected before it was published, so there won't be a delivery report
+			kafkaMessage.TopicPartition.Error = err
+			deliveries <- kafkaMessage
+		}
+	}
+
+	waiting.Wait()
+	close(deliveries)
+	<-done
+
+	result.Duration = time.Since(startTime)
+	if sourceErr != nil {
+		return result, fmt.Errorf("unable to read message: %v", sourceErr)
+	}
+
+	return result, nil
+}
+
+// isQueueFull returns true if the error is caused by a full local producer queue
+func isQueueFull(err error) bool {
+	kafkaError, ok := err.(kafka.Error)
+	return ok && kafkaError.Code() == kafka.ErrQueueFull
+}
+
+// StopProducer waits for outstanding messages and closes the producer
+func StopProducer(producer Producer) {
+	producer.Flush(10000)
+	producer.Close()
+}
+
+func createKafkaMessage(message *Message, index int64) *kafka.Message {
+	topic := message.Topic
+	var headers []kafka.Header
+	for _, header := range message.Headers {
+		headers = append(headers, kafka.Header{Key: header.Key, Value: []byte(header.Value)})
+	}
+
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: message.Partition},
+		Key:            []byte(message.Key),
+		Value:          []byte(message.Value),
+		Headers:        headers,
+		Timestamp:      message.Timestamp,
+		Opaque:         index,
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/karldahlgren/raccoon/kafka/kafkatest"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The in-memory producer must be usable wherever a Kafka producer is
+var _ Producer = (*kafkatest.Producer)(nil)
+
+// createSource returns a source of the provided messages
+func createSource(messages ...*Message) MessageSource {
+	return func() (*Message, error) {
+		if len(messages) == 0 {
+			return nil, io.EOF
+		}
+
+		message := messages[0]
+		messages = messages[1:]
+		return message, nil
+	}
+}
+
+func TestProduceReportsTheDeliveryOfEachMessage(t *testing.T) {
+	cluster := kafkatest.NewCluster()
+	cluster.CreateTopic("orders", 2)
+	producer := cluster.NewProducer()
+	defer producer.Close()
+
+	timestamp := time.Date(2021, 1, 1, 14, 0, 0, 0, time.UTC)
+	source := createSource(
+		&Message{Topic: "orders", Partition: 1, Key: "1", Value: "first", Timestamp: timestamp,
+			Headers: []Header{{Key: "type", Value: "test"}}},
+		&Message{Topic: "orders", Partition: 1, Key: "2", Value: "second"},
+		&Message{Topic: "missing", Partition: AnyPartition, Value: "lost"})
+
+	deliveries := make(map[int64]Delivery)
+	result, err := Produce(context.Background(), producer, source, func(delivery Delivery) {
+		deliveries[delivery.Index] = delivery
+	})
+	if err != nil {
+		t.Fatalf("unable to produce: %v", err)
+	}
+
+	if result.ProducedMessages != 2 || result.FailedMessages != 1 || len(deliveries) != 3 {
+		t.Fatalf("expected 2 produced and 1 failed message, got %d produced, %d failed and %d reports",
+			result.ProducedMessages, result.FailedMessages, len(deliveries))
+	}
+	if deliveries[0].Err != nil || deliveries[0].Message.Offset != 0 || deliveries[1].Message.Offset != 1 {
+		t.Errorf("expected the messages at offsets 0 and 1, got %+v and %+v", deliveries[0], deliveries[1])
+	}
+	if deliveries[2].Err == nil {
+		t.Errorf("expected the message to the missing topic to fail")
+	}
+
+	// The produced messages can be read back
+	consumer := cluster.NewConsumer("earliest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	readResult, err := Consume(context.Background(), []Consumer{consumer}, partitions, ConsumeOptions{})
+	if err != nil {
+		t.Fatalf("unable to consume: %v", err)
+	}
+	defer readResult.Close()
+
+	var messages []Message
+	_ = readResult.Each(func(message *Message) error {
+		messages = append(messages, *message)
+		return nil
+	})
+
+	expected := Message{Topic: "orders", Partition: 1, Offset: 0, Key: "1", Value: "first", Timestamp: timestamp,
+		Headers: []Header{{Key: "type", Value: "test"}}}
+	if len(messages) != 2 || !reflect.DeepEqual(messages[0], expected) || messages[1].Value != "second" {
+		t.Errorf("expected the produced messages, got %+v", messages)
+	}
+}
+
+func TestProduceStopsAtSourceError(t *testing.T) {
+	cluster := kafkatest.NewCluster()
+	cluster.CreateTopic("orders", 1)
+	producer := cluster.NewProducer()
+	defer producer.Close()
+
+	sent := false
+	source := func() (*Message, error) {
+		if sent {
+			return nil, errors.New("invalid line")
+		}
+		sent = true
+		return &Message{Topic: "orders", Partition: AnyPartition, Value: "value"}, nil
+	}
+
+	result, err := Produce(context.Background(), producer, source, nil)
+	if err == nil {
+		t.Fatalf("expected the source error to be returned")
+	}
+	if result.ProducedMessages != 1 {
+		t.Errorf("expected the message before the error to be produced, got %d", result.ProducedMessages)
+	}
+}
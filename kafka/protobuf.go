@@ -0,0 +1,132 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io/ioutil"
+)
+
+// ProtobufDecoder decodes protobuf messages of a particular message type into canonical JSON.
+// Messages serialized with the Confluent wire format are supported as well
+type ProtobufDecoder struct {
+	descriptor protoreflect.MessageDescriptor
+}
+
+// CreateProtobufDecoder creates a decoder for a fully qualified message type, e.g. com.example.Order,
+// from a file descriptor set created with `protoc --include_imports --descriptor_set_out=file.desc`
+func CreateProtobufDecoder(descriptorSetPath string, messageName string) (*ProtobufDecoder, error) {
+	data, err := ioutil.ReadFile(descriptorSetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, descriptorSet); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %v", descriptorSetPath, err)
+	}
+
+	files, err := protodesc.NewFiles(descriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %v", descriptorSetPath, err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		return nil, fmt.Errorf("message type %s not found in %s", messageName, descriptorSetPath)
+	}
+
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s in %s is not a message type", messageName, descriptorSetPath)
+	}
+
+	return &ProtobufDecoder{descriptor: messageDescriptor}, nil
+}
+
+// Decode decodes a protobuf message into JSON
+func (decoder *ProtobufDecoder) Decode(data []byte) ([]byte, error) {
+	// A protobuf message can't start with a zero byte, since zero isn't a valid field number.
+	// A leading zero byte is therefore the magic byte of the Confluent wire format
+	if len(data) > 0 && data[0] == 0 {
+		_, payload, err := parseWireFormat(data)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = skipMessageIndexes(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	message := dynamicpb.NewMessage(decoder.descriptor)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %v", decoder.descriptor.FullName(), err)
+	}
+
+	decoded, err := protojson.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	// The protojson output is deliberately unstable, so it is compacted into a canonical form
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, decoded); err != nil {
+		return nil, err
+	}
+
+	return compacted.Bytes(), nil
+}
+
+// skipMessageIndexes skips the message indexes of the Confluent protobuf wire format, which
+// identify the message type within the registered schema
+func skipMessageIndexes(data []byte) ([]byte, error) {
+	count, read := binary.Varint(data)
+	if read <= 0 || count < 0 {
+		return nil, errors.New("invalid message indexes in the schema registry wire format")
+	}
+	data = data[read:]
+
+	for index := int64(0); index < count; index++ {
+		_, read = binary.Varint(data)
+		if read <= 0 {
+			return nil, errors.New("invalid message indexes in the schema registry wire format")
+		}
+		data = data[read:]
+	}
+
+	return data, nil
+}
@@ -0,0 +1,173 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidJSON is returned when a JSON field is evaluated on a message value which isn't valid JSON
+var ErrInvalidJSON = errors.New("message value is not valid JSON")
+
+// Query contains the compiled expression used to match messages
+type Query struct {
+	expression Expression
+}
+
+// record is a message being evaluated by a query. The JSON value is decoded at most once
+type record struct {
+	message  *kafka.Message
+	document interface{}
+	decoded  bool
+	invalid  bool
+}
+
+// CreateQuery creates a new query from a key query, a value query, a list of header queries, a list of
+// predicates and a query expression. The key, value and header queries are compiled once as regular expressions
+// if regex is enabled, otherwise they are matched as case-insensitive substrings. A message must match either
+// the key or the value query, all header queries, all predicates and the query expression. A query without any
+// of them matches no messages, unlike a nil query which matches every message
+func CreateQuery(keyQuery string, valueQuery string, headerQueries []string, regex bool, where []string,
+	filter string) (*Query, error) {
+	var expressions []Expression
+	for _, text := range where {
+		predicate, err := CreatePredicate(text)
+		if err != nil {
+			return nil, err
+		}
+
+		expressions = append(expressions, predicate)
+	}
+
+	for _, headerQuery := range headerQueries {
+		name, value := headerQuery, ""
+		if separator := strings.Index(headerQuery, "="); separator != -1 {
+			name, value = headerQuery[:separator], headerQuery[separator+1:]
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("invalid header query %q. Expected name=value", headerQuery)
+		}
+
+		headerCondition, err := createQueryCondition(field{name: "header", header: name}, value, regex)
+		if err != nil {
+			return nil, err
+		}
+
+		if headerCondition == nil {
+			// Only verify that the header exists
+			headerCondition = &condition{field: field{name: "header", header: name}, operator: "exists"}
+		}
+
+		expressions = append(expressions, headerCondition)
+	}
+
+	keyCondition, err := createQueryCondition(field{name: "key"}, keyQuery, regex)
+	if err != nil {
+		return nil, err
+	}
+
+	valueCondition, err := createQueryCondition(field{name: "value"}, valueQuery, regex)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyCondition != nil && valueCondition != nil {
+		expressions = append(expressions, &orExpression{left: keyCondition, right: valueCondition})
+	} else if keyCondition != nil {
+		expressions = append(expressions, keyCondition)
+	} else if valueCondition != nil {
+		expressions = append(expressions, valueCondition)
+	}
+
+	if filter != "" {
+		expression, err := ParseExpression(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		expressions = append(expressions, expression)
+	}
+
+	if len(expressions) == 0 {
+		// Nothing to search for, so no messages will match
+		return &Query{expression: &constantExpression{value: false}}, nil
+	}
+
+	expression := expressions[0]
+	for _, next := range expressions[1:] {
+		expression = &andExpression{left: expression, right: next}
+	}
+
+	return &Query{expression: expression}, nil
+}
+
+func createQueryCondition(selectedField field, query string, regex bool) (Expression, error) {
+	if query == "" {
+		return nil, nil
+	}
+
+	if !regex {
+		return &condition{field: selectedField, operator: "contains", value: strings.ToLower(query)}, nil
+	}
+
+	compiled, err := regexp.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &condition{field: selectedField, operator: "~", regex: compiled}, nil
+}
+
+func (query *Query) matches(message *kafka.Message) (bool, error) {
+	if query == nil {
+		// A missing query matches every message
+		return true, nil
+	}
+
+	record := &record{message: message}
+	matched := query.expression.evaluate(record)
+	if record.invalid {
+		return false, ErrInvalidJSON
+	}
+
+	return matched, nil
+}
+
+func (record *record) json() (interface{}, bool) {
+	if !record.decoded {
+		record.decoded = true
+		if err := json.Unmarshal(record.message.Value, &record.document); err != nil {
+			record.invalid = true
+		}
+	}
+
+	return record.document, !record.invalid
+}
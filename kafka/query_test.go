@@ -0,0 +1,66 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+package kafka
+
+import (
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"testing"
+)
+
+func TestHeaderQueries(t *testing.T) {
+	message := &kafka.Message{
+		Key:   []byte("42"),
+		Value: []byte("created"),
+		Headers: []kafka.Header{{Key: "trace-id", Value: []byte("4bf92f35")}, {Key: "replayed", Value: []byte{}},
+			{Key: "type", Value: []byte("Test")}},
+	}
+
+	tests := []struct {
+		headerQueries []string
+		regex         bool
+		expected      bool
+	}{
+		{headerQueries: []string{"trace-id"}, expected: true},
+		{headerQueries: []string{"replayed"}, expected: true},
+		{headerQueries: []string{"replayed="}, expected: true},
+		{headerQueries: []string{"missing"}, expected: false},
+		{headerQueries: []string{"trace-id=4BF9"}, expected: true},
+		{headerQueries: []string{"trace-id=4bf92f36"}, expected: false},
+		{headerQueries: []string{"trace-id=4bf9", "replayed"}, expected: true},
+		{headerQueries: []string{"trace-id=4bf9", "missing"}, expected: false},
+		{headerQueries: []string{"type=^T"}, regex: true, expected: true},
+		{headerQueries: []string{"type=^t"}, regex: true, expected: false},
+	}
+
+	for _, test := range tests {
+		query, err := CreateQuery("", "", test.headerQueries, test.regex, nil, "")
+		if err != nil {
+			t.Fatalf("unable to create query %v: %v", test.headerQueries, err)
+		}
+
+		if matched, err := query.matches(message); err != nil || matched != test.expected {
+			t.Errorf("expected %v to give %t, got %t and %v", test.headerQueries, test.expected, matched, err)
+		}
+	}
+}
@@ -25,7 +25,6 @@
 package kafka
 
 import (
-	"container/list"
 	"time"
 )
 
@@ -33,6 +32,80 @@ import (
 type Result struct {
 	MatchedMessages    int64
 	ReadMessages    int64
+	InvalidMessages int64
+	UndecodableMessages int64
 	Duration time.Duration
-	Messages list.List
+	// StartOffsets contains the offset each partition was read from. It's empty for partitions read
+	// through a subscription, such as by a tail
+	StartOffsets map[PartitionID]int64
+	// IdleTimedOut is true if reading stopped before the end of a partition because nothing was read
+	// within the idle timeout
+	IdleTimedOut bool
+	// Interrupted is true if reading stopped because the context was cancelled, in which case messages
+	// may be missing from the result
+	Interrupted bool
+	collectors []*collector
+}
+
+// CollectedMessages returns the number of matched messages collected in the result, both in memory
+// and spilled to disk. Messages passed to a handler aren't collected
+func (result Result) CollectedMessages() int64 {
+	total := int64(0)
+	for _, collector := range result.collectors {
+		total += collector.len()
+	}
+
+	return total
+}
+
+// Each calls the handler with each collected message in the order they were matched. Iteration stops at
+// the first error returned by the handler
+func (result Result) Each(handler func(message *Message) error) error {
+	for _, collector := range result.collectors {
+		if err := collector.each(handler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close removes the temporary files of messages spilled to disk
+func (result Result) Close() error {
+	var err error
+	for _, collector := range result.collectors {
+		if removeErr := collector.remove(); err == nil {
+			err = removeErr
+		}
+	}
+
+	return err
+}
+
+// MergeResults combines the result of an earlier operation with the result of a later operation
+func MergeResults(earlier Result, later Result) Result {
+	var collectors []*collector
+	collectors = append(collectors, earlier.collectors...)
+	collectors = append(collectors, later.collectors...)
+
+	// The earlier operation started reading each partition first
+	startOffsets := make(map[PartitionID]int64)
+	for id, offset := range later.StartOffsets {
+		startOffsets[id] = offset
+	}
+	for id, offset := range earlier.StartOffsets {
+		startOffsets[id] = offset
+	}
+
+	return Result{
+		MatchedMessages: earlier.MatchedMessages + later.MatchedMessages,
+		ReadMessages: earlier.ReadMessages + later.ReadMessages,
+		InvalidMessages: earlier.InvalidMessages + later.InvalidMessages,
+		UndecodableMessages: earlier.UndecodableMessages + later.UndecodableMessages,
+		Duration: earlier.Duration + later.Duration,
+		StartOffsets: startOffsets,
+		IdleTimedOut: earlier.IdleTimedOut || later.IdleTimedOut,
+		Interrupted: earlier.Interrupted || later.Interrupted,
+		collectors: collectors,
+	}
 }
@@ -25,93 +25,129 @@
 package kafka
 
 import (
-	"github.com/karldahlgren/raccoon/utility"
+	"fmt"
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
-	"strconv"
 	"time"
 )
 
-func seekToTimestamp(consumer *kafka.Consumer, partitions map[int32]Partition, topic string, seekTimestamp string) map[int32]Partition  {
-	timestamp, err := time.Parse(time.RFC3339, seekTimestamp)
+// startAtTimestamp sets the low offset of each partition to the first offset at or after the timestamp,
+// so that reading starts at the timestamp once the partitions are assigned
+func startAtTimestamp(consumer Consumer, partitions map[PartitionID]Partition, timestamp time.Time) (map[PartitionID]Partition, error) {
+	offsets, err := getOffsetsForTime(consumer, partitions, timestamp)
+	if err != nil {
+		return nil, err
+	}
 
+	return startAtOffsets(partitions, offsets), nil
+}
+
+// limitToTimestamp sets the high offset of each partition to the first offset after the timestamp,
+// so that a partition stops being read once it has passed the timestamp
+func limitToTimestamp(consumer Consumer, partitions map[PartitionID]Partition, timestamp time.Time) (map[PartitionID]Partition, error) {
+	// The end timestamp is inclusive
+	offsets, err := getOffsetsForTime(consumer, partitions, timestamp.Add(time.Millisecond))
 	if err != nil {
-		utility.ExitOnError(err)
+		return nil, err
+	}
+
+	limitedPartitions := make(map[PartitionID]Partition)
+	for id, partition := range partitions {
+		if offset, ok := offsets[id]; ok && offset < partition.highOffset {
+			partition.highOffset = offset
+		}
+		if partition.lowOffset > partition.highOffset {
+			partition.lowOffset = partition.highOffset
+		}
+
+		limitedPartitions[id] = partition
 	}
 
+	return limitedPartitions, nil
+}
+
+// getOffsetsForTime returns the earliest offset of each partition whose timestamp is equal to or later
+// than the provided timestamp. The high offset is returned for partitions without any such message
+func getOffsetsForTime(consumer Consumer, partitions map[PartitionID]Partition, timestamp time.Time) (map[PartitionID]int64, error) {
 	var topicPartitions []kafka.TopicPartition
 	for _, partition := range partitions {
+		topic := partition.topic
 		topicPartition := kafka.TopicPartition{
 			Topic: &topic,
 			Partition: partition.id,
-			Offset: kafka.Offset(timestamp.Round(time.Millisecond).Unix() * 1000),
+			Offset: kafka.Offset(timestamp.UnixNano() / int64(time.Millisecond)),
 		}
 
 		topicPartitions = append(topicPartitions, topicPartition)
 	}
 
 	offsetTopicPartitions, err := consumer.OffsetsForTimes(topicPartitions, -1)
-	var newOffsetPartitions []kafka.TopicPartition
+	if err != nil {
+		return nil, fmt.Errorf("unable to find offsets for %s: %v", timestamp.Format(time.RFC3339), err)
+	}
+
+	offsets := make(map[PartitionID]int64)
 	for _, partition := range offsetTopicPartitions {
-		newOffset := partition.Offset
-		if partition.Offset == -1 {
-			newOffset = kafka.Offset(partitions[partition.Partition].highOffset)
-			partition.Offset = newOffset
-		}
-		newOffsetPartition := kafka.TopicPartition{
-			Topic: &topic,
-			Partition: partition.Partition,
-			Offset: newOffset,
+		id := PartitionID{Topic: *partition.Topic, Partition: partition.Partition}
+		offset := int64(partition.Offset)
+		if partition.Offset < 0 {
+			offset = partitions[id].highOffset
 		}
 
-		newOffsetPartitions = append(newOffsetPartitions, newOffsetPartition)
+		offsets[id] = offset
 	}
 
-	return seek(consumer, newOffsetPartitions, partitions)
+	return offsets, nil
 }
 
-func seekToLatest(consumer *kafka.Consumer, partitions map[int32]Partition, topic string, limit int64) map[int32]Partition {
-	var newOffsetPartitions []kafka.TopicPartition
-	for _, partition := range partitions {
-		offset := partition.highOffset - limit
+// startAtLatest sets the low offset of each partition to the high offset minus the limit, so that reading
+// starts at the last messages of each partition once the partitions are assigned
+func startAtLatest(partitions map[PartitionID]Partition, limit int64) map[PartitionID]Partition {
+	offsets := make(map[PartitionID]int64)
+	for id, partition := range partitions {
+		offsets[id] = partition.highOffset - limit
+	}
 
-		if offset < partition.lowOffset {
-			offset = partition.lowOffset
-		}
+	return startAtOffsets(partitions, offsets)
+}
 
-		topicPartition := kafka.TopicPartition{
-			Topic: &topic,
-			Partition: partition.id,
-			Offset: kafka.Offset(offset),
+// startAtOffsets sets the low offset of each partition to its start offset, without moving it outside
+// of the partition
+func startAtOffsets(partitions map[PartitionID]Partition, offsets map[PartitionID]int64) map[PartitionID]Partition {
+	updatedPartitions := make(map[PartitionID]Partition)
+	for id, partition := range partitions {
+		if offset, ok := offsets[id]; ok {
+			if offset > partition.highOffset {
+				offset = partition.highOffset
+			}
+			if offset > partition.lowOffset {
+				partition.lowOffset = offset
+			}
 		}
 
-		newOffsetPartitions = append(newOffsetPartitions, topicPartition)
+		updatedPartitions[id] = partition
 	}
 
-	return seek(consumer, newOffsetPartitions, partitions)
+	return updatedPartitions
 }
 
-func seek(consumer *kafka.Consumer, topicPartitions []kafka.TopicPartition,
-	partitions map[int32]Partition) map[int32]Partition  {
+// assignPartitions assigns the partitions to the consumer, which reads each partition from its low offset
+func assignPartitions(consumer Consumer, partitions map[PartitionID]Partition) error {
+	var topicPartitions []kafka.TopicPartition
+	for _, partition := range partitions {
+		topic := partition.topic
+		topicPartition := kafka.TopicPartition{
+			Topic: &topic,
+			Partition: partition.id,
+			Offset: kafka.Offset(partition.lowOffset),
+		}
 
-	_,err := consumer.StoreOffsets(topicPartitions)
-	if err != nil && err.(kafka.Error).IsFatal() == true {
-		utility.ExitOnError(err)
+		topicPartitions = append(topicPartitions, topicPartition)
 	}
 
-	updatedPartitions := make(map[int32]Partition)
-	for _,newOffsetPartition := range topicPartitions {
-		lowOffset, err := strconv.ParseInt(newOffsetPartition.Offset.String(), 10, 64)
-
-		if err != nil {
-			utility.ExitOnError(err)
-		}
-
-		updatedPartitions[newOffsetPartition.Partition] = Partition {
-			id: newOffsetPartition.Partition,
-			lowOffset: lowOffset,
-			highOffset: partitions[newOffsetPartition.Partition].highOffset,
-		}
+	err := consumer.Assign(topicPartitions)
+	if err != nil {
+		return fmt.Errorf("unable to assign partitions: %v", err)
 	}
 
-	return updatedPartitions
-}
\ No newline at end of file
+	return nil
+}
@@ -25,76 +25,111 @@
 package kafka
 
 import (
-	"container/list"
+	"context"
 	"fmt"
-	"github.com/jedib0t/go-pretty/v6/progress"
-	"github.com/karldahlgren/raccoon/utility"
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
-	"strconv"
 	"time"
 )
 
-// Tail messages from a Kafka consumer
-func Tail(consumer *kafka.Consumer, keyQuery string, valueQuery string, limit int64, tracker *progress.Tracker) Result {
-	messages := list.New()
+// Tail messages from a Kafka consumer until the context is cancelled, or until the limit has been reached
+// unless it's -1. Matched messages are collected in the result, unless a handler is provided, in which case
+// each matched message is passed to the handler instead. Matched messages are spilled to disk once
+// spillThreshold messages are held in memory, unless it's zero. Tailing stops with an error once the
+// consumer reports a fatal error
+func Tail(ctx context.Context, consumer Consumer, query *Query, decoders Decoders, limit int64, spillThreshold int64,
+	handler MessageHandler, progress ProgressFunc) (Result, error) {
+	messages := createCollector(spillThreshold)
 	var matchedMessages int64 = 0
 	var readMessages int64 = 0
-	var index int64 = 0
+	var invalidMessages int64 = 0
+	var undecodableMessages int64 = 0
+	var collectErr error
 	startTime := time.Now()
-	running := true
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Messages are read on a separate goroutine and passed over a channel, so that the
+	// counters and the matched messages are only accessed by the calling goroutine. The read error
+	// is only accessed once the channel has been closed
+	var readErr error
+	records := make(chan *kafka.Message)
 	go func() {
-		if limit != -1 {
-			for ; index < limit && running; index++ {
-				msg, err := consumer.ReadMessage(-1)
-
-				if err == nil {
-					readMessages++
-					message := parseMessage(msg, keyQuery, valueQuery)
-					if message != nil {
-						matchedMessages++
-						tracker.Message = "Reading messages (" + strconv.FormatInt(matchedMessages, 10) + " matches)"
-						messages.PushFront(message)
-					}
-				}
-				tracker.Increment(1)
+		defer close(records)
+		for ctx.Err() == nil {
+			msg, err := consumer.ReadMessage(readTimeout)
+			if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.IsFatal() {
+				readErr = err
+				return
+			} else if err != nil {
+				// Timeouts and other errors, such as lost broker connections, are retried
+				continue
 			}
-		} else {
-			// No limit
-			for running {
-				msg, err := consumer.ReadMessage(1000)
-
-				if err == nil {
-					readMessages++
-					message := parseMessage(msg, keyQuery, valueQuery)
-					if message != nil {
-						matchedMessages++
-						tracker.Message = "Reading messages (" + strconv.FormatInt(matchedMessages, 10) + " matches)"
-						messages.PushFront(message)
-					}
-				}
+
+			select {
+			case records <- msg:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 
-	_, err := fmt.Scanln()
+	if progress != nil {
+		progress(0, limit, 0)
+	}
+
+	for msg := range records {
+		readMessages++
+		message, err := parseMessage(msg, query, decoders)
+		if _, ok := err.(*DecodeError); ok {
+			undecodableMessages++
+		} else if err != nil {
+			invalidMessages++
+		} else if message != nil {
+			matchedMessages++
+			if handler != nil {
+				handler(message)
+			} else if err := messages.add(message); err != nil {
+				collectErr = err
+				break
+			}
+		}
+
+		if progress != nil {
+			progress(readMessages, limit, matchedMessages)
+		}
+
+		if limit != -1 && readMessages >= limit {
+			break
+		}
+	}
 
-	if err != nil {
-		running = false
-		tracker.MarkAsDone()
-		utility.ExitOnError(err)
+	// Stop the reader and wait for it to finish before the consumer can be closed
+	cancel()
+	for range records {
 	}
 
 	stopTime := time.Now()
 	elapsedTime := stopTime.Sub(startTime)
 
-	// Sleep for the progress to catch up
-	time.Sleep(100 * time.Millisecond)
-	tracker.MarkAsDone()
+	if err := messages.finish(); err != nil && collectErr == nil {
+		collectErr = err
+	}
 
-	return Result{
-		Messages: *messages,
+	result := Result{
 		MatchedMessages:    matchedMessages,
+		InvalidMessages: invalidMessages,
+		UndecodableMessages: undecodableMessages,
 		ReadMessages: readMessages,
 		Duration: elapsedTime,
+		collectors: []*collector{messages},
+	}
+
+	if readErr != nil {
+		return result, readErr
+	} else if collectErr != nil {
+		return result, fmt.Errorf("unable to collect matched messages: %v", collectErr)
 	}
+
+	return result, nil
 }
@@ -0,0 +1,202 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package kafka
+
+import (
+	"context"
+	"github.com/karldahlgren/raccoon/kafka/kafkatest"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// produceUntilDone keeps producing messages to each partition of the topic until done is closed
+func produceUntilDone(cluster *kafkatest.Cluster, topic string, partitions int, done <-chan struct{}) {
+	for {
+		for partition := 0; partition < partitions; partition++ {
+			cluster.Produce(topic, int32(partition), "key", "new", time.Now())
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestTailOnlyReadsNewMessagesUntilTheLimit(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	consumer := cluster.NewConsumer("latest")
+	defer consumer.Close()
+
+	if err := Subscribe(consumer, []string{"orders"}); err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	done := make(chan struct{})
+	go produceUntilDone(cluster, "orders", 2, done)
+	result, err := Tail(context.Background(), consumer, nil, Decoders{}, 5, 0, nil, nil)
+	close(done)
+	if err != nil {
+		t.Fatalf("unable to tail: %v", err)
+	}
+	defer result.Close()
+
+	if result.ReadMessages != 5 || result.CollectedMessages() != 5 {
+		t.Errorf("expected 5 read messages, got %d read and %d collected", result.ReadMessages, result.CollectedMessages())
+	}
+
+	_ = result.Each(func(message *Message) error {
+		if message.Offset < 10 {
+			t.Errorf("expected only new messages, got offset %d of partition %d", message.Offset, message.Partition)
+		}
+		return nil
+	})
+}
+
+func TestTailStopsWhenCancelled(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	consumer := cluster.NewConsumer("latest")
+	defer consumer.Close()
+
+	if err := Subscribe(consumer, []string{"orders"}); err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200 * time.Millisecond)
+	defer cancel()
+
+	result, err := Tail(ctx, consumer, nil, Decoders{}, -1, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to tail: %v", err)
+	}
+	defer result.Close()
+
+	if result.ReadMessages != 0 {
+		t.Errorf("expected no read messages, got %d", result.ReadMessages)
+	}
+}
+
+func TestTailStopsOnFatalErrors(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	consumer := cluster.NewConsumer("latest")
+
+	if err := Subscribe(consumer, []string{"orders"}); err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	// A closed consumer reports a fatal error on each read
+	_ = consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+
+	result, err := Tail(ctx, consumer, nil, Decoders{}, -1, 0, nil, nil)
+	defer result.Close()
+
+	if kafkaErr, ok := err.(kafka.Error); !ok || !kafkaErr.IsFatal() {
+		t.Fatalf("expected a fatal error, got %v", err)
+	} else if ctx.Err() != nil {
+		t.Errorf("expected the tail to stop before the context was cancelled")
+	}
+}
+
+func TestTailPassesMatchedMessagesToTheHandler(t *testing.T) {
+	cluster := createTestCluster("orders", 1, 0)
+	consumer := cluster.NewConsumer("latest")
+	defer consumer.Close()
+
+	if err := Subscribe(consumer, []string{"orders"}); err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+
+	var handled []string
+	done := make(chan struct{})
+	go produceUntilDone(cluster, "orders", 1, done)
+	result, err := Tail(context.Background(), consumer, nil, Decoders{}, 3, 0, func(message *Message) {
+		handled = append(handled, message.Value)
+	}, nil)
+	close(done)
+	if err != nil {
+		t.Fatalf("unable to tail: %v", err)
+	}
+	defer result.Close()
+
+	if !reflect.DeepEqual(handled, []string{"new", "new", "new"}) || result.CollectedMessages() != 0 {
+		t.Errorf("expected 3 handled and no collected messages, got %v and %d", handled, result.CollectedMessages())
+	}
+}
+
+func TestCatchUpReadsEarlierMessagesBeforeTail(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	consumer := cluster.NewConsumer("latest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	catchUpResult, err := CatchUp(context.Background(), consumer, partitions, CatchUpOptions{LatestMinus: 3})
+	if err != nil {
+		t.Fatalf("unable to catch up: %v", err)
+	}
+
+	expected := map[int32][]int64{0: offsetsBetween(7, 10), 1: offsetsBetween(7, 10)}
+	if offsets := getOffsets(t, catchUpResult); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+
+	// Messages published after catching up are read by the tail
+	cluster.Produce("orders", 0, "key", "new", time.Now())
+	cluster.Produce("orders", 1, "key", "new", time.Now())
+
+	result, err := Tail(context.Background(), consumer, nil, Decoders{}, 2, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to tail: %v", err)
+	}
+
+	result = MergeResults(catchUpResult, result)
+	defer result.Close()
+
+	expected = map[int32][]int64{0: offsetsBetween(7, 11), 1: offsetsBetween(7, 11)}
+	if offsets := getOffsets(t, result); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+}
+
+func TestCatchUpFromTheEarliestOffset(t *testing.T) {
+	cluster := createTestCluster("orders", 2, 10)
+	consumer := cluster.NewConsumer("latest")
+	defer consumer.Close()
+
+	partitions := getTestPartitions(t, consumer, "orders")
+	result, err := CatchUp(context.Background(), consumer, partitions, CatchUpOptions{Earliest: true})
+	if err != nil {
+		t.Fatalf("unable to catch up: %v", err)
+	}
+	defer result.Close()
+
+	if result.ReadMessages != 20 {
+		t.Errorf("expected 20 read messages, got %d", result.ReadMessages)
+	}
+}
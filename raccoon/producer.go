@@ -0,0 +1,75 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package raccoon
+
+import (
+	"context"
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+)
+
+// AnyPartition lets the producer choose the partition of a message
+const AnyPartition = kafka.AnyPartition
+
+// MessageSource returns the next message to produce, or io.EOF once there are no more messages
+type MessageSource = kafka.MessageSource
+
+// Delivery is the delivery report of a produced message
+type Delivery = kafka.Delivery
+
+// DeliveryHandler is called with the delivery report of each produced message
+type DeliveryHandler = kafka.DeliveryHandler
+
+// ProduceResult contains the statistics of producing messages
+type ProduceResult = kafka.ProduceResult
+
+// ProduceOptions configures a producer
+type ProduceOptions struct {
+	// Handler is called with the delivery report of each message, unless it's nil
+	Handler DeliveryHandler
+}
+
+// Producer publishes messages to Kafka topics
+type Producer struct {
+	connection Connection
+	options    ProduceOptions
+}
+
+// NewProducer creates a producer
+func NewProducer(connection Connection, options ProduceOptions) (*Producer, error) {
+	return &Producer{connection: connection, options: options}, nil
+}
+
+// Produce publishes the messages of the source until it's exhausted or the context is cancelled, and waits
+// for their delivery. Messages that couldn't be delivered are counted and reported, but don't stop producing
+func (producer *Producer) Produce(ctx context.Context, source MessageSource) (ProduceResult, error) {
+	kafkaProducer, err := kafka.CreateProducer(producer.connection)
+	if err != nil {
+		return ProduceResult{}, fmt.Errorf("unable to create producer: %w", err)
+	}
+	defer kafka.StopProducer(kafkaProducer)
+
+	return kafka.Produce(ctx, kafkaProducer, source, producer.options.Handler)
+}
@@ -0,0 +1,86 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package raccoon
+
+import "github.com/karldahlgren/raccoon/kafka"
+
+// Stage is a step of a search or a tail
+type Stage int
+
+const (
+	// StageConnecting connects to Kafka and subscribes to the topics
+	StageConnecting Stage = iota
+	// StageReadingMetadata reads the partition metadata of the topics
+	StageReadingMetadata
+	// StageConnectingWorkers connects the additional consumers of the workers to Kafka
+	StageConnectingWorkers
+	// StageCatchingUp reads the messages published before a tail
+	StageCatchingUp
+	// StageReading reads and matches messages
+	StageReading
+	// StageDisconnecting disconnects from Kafka
+	StageDisconnecting
+)
+
+// Progress receives the progress of a search or a tail. Its methods are only called from one goroutine at a time
+type Progress interface {
+	// Started is called when a stage starts
+	Started(stage Stage)
+	// Updated is called with the number of processed items, the total number of items, or -1 if the
+	// total is unknown, and the number of matched messages
+	Updated(stage Stage, current int64, total int64, matches int64)
+	// Done is called when a stage has ended, whether it succeeded or not
+	Done(stage Stage)
+}
+
+// reporter forwards progress to an optional Progress
+type reporter struct {
+	progress Progress
+}
+
+func (reporter reporter) started(stage Stage) {
+	if reporter.progress != nil {
+		reporter.progress.Started(stage)
+	}
+}
+
+func (reporter reporter) updated(stage Stage, current int64, total int64, matches int64) {
+	if reporter.progress != nil {
+		reporter.progress.Updated(stage, current, total, matches)
+	}
+}
+
+func (reporter reporter) done(stage Stage) {
+	if reporter.progress != nil {
+		reporter.progress.Done(stage)
+	}
+}
+
+// progressFunc reports the progress of reading messages as a stage
+func (reporter reporter) progressFunc(stage Stage) kafka.ProgressFunc {
+	return func(read int64, total int64, matched int64) {
+		reporter.updated(stage, read, total, matched)
+	}
+}
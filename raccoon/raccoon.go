@@ -0,0 +1,84 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+// Package raccoon searches and tails Kafka topics. A Searcher reads the messages already published on
+// a number of topics, while a Tailer follows the messages published on them from now on. Both report
+// their progress through an optional Progress, return errors instead of exiting, and stop once their
+// context is cancelled
+package raccoon
+
+import (
+	"errors"
+	"github.com/karldahlgren/raccoon/kafka"
+)
+
+// Connection contains the settings used to connect to Kafka
+type Connection = kafka.Connection
+
+// Query selects the messages to match
+type Query = kafka.Query
+
+// Decoders decode the keys and values of the messages before they are matched
+type Decoders = kafka.Decoders
+
+// Message is a matched message
+type Message = kafka.Message
+
+// MessageHandler is called with each matched message as soon as it has been matched
+type MessageHandler = kafka.MessageHandler
+
+// Result contains the matched messages and the statistics of a search or a tail.
+// Close must be called once the result is no longer used
+type Result = kafka.Result
+
+// Assignment selects the partitions, and optionally the offset ranges, to read
+type Assignment = kafka.Assignment
+
+var (
+	// ErrNoTopics is returned if neither topics nor a topic pattern have been provided
+	ErrNoTopics = errors.New("a topic or a topic pattern is required")
+	// ErrConflictingStart is returned if more than one start position has been provided
+	ErrConflictingStart = errors.New("only one start position can be provided")
+	// ErrInvalidTimeWindow is returned if the end time isn't after the start time
+	ErrInvalidTimeWindow = errors.New("the end time must be after the start time")
+	// ErrEmptyQuery is returned if a query is created without any conditions
+	ErrEmptyQuery = errors.New("a query requires at least one condition")
+)
+
+// CreateQuery creates a query from key, value and header queries, JSON value predicates and a query
+// expression. At least one of them must be provided, otherwise ErrEmptyQuery is returned. Searches and
+// tails without a query, rather than with an empty one, match every message
+func CreateQuery(keyQuery string, valueQuery string, headerQueries []string, regex bool, where []string,
+	filter string) (*Query, error) {
+	if keyQuery == "" && valueQuery == "" && len(headerQueries) == 0 && len(where) == 0 && filter == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	return kafka.CreateQuery(keyQuery, valueQuery, headerQueries, regex, where, filter)
+}
+
+// CreateAssignment creates an assignment from partition IDs and offset ranges written as partition:start-end
+func CreateAssignment(partitions []int32, offsets []string) (*Assignment, error) {
+	return kafka.CreateAssignment(partitions, offsets)
+}
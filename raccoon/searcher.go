@@ -0,0 +1,190 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package raccoon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+	"time"
+)
+
+// SearchOptions configures a search
+type SearchOptions struct {
+	// Topics to search
+	Topics []string
+	// TopicPattern is a regular expression matching the names of additional topics to search
+	TopicPattern string
+	// Group is the consumer group name. A random group name is used if it's empty
+	Group string
+	// Query selects the messages to match. Every message is matched if it's nil
+	Query *Query
+	// Decoders decode the keys and values of the messages before they are matched
+	Decoders Decoders
+	// Limit is the maximum number of messages read per partition. 0 is no limit
+	Limit int64
+	// From is the time to start reading at, unless it's zero
+	From time.Time
+	// To is the time to stop reading each partition at, unless it's zero
+	To time.Time
+	// Latest starts reading at the latest offset minus the limit of each partition
+	Latest bool
+	// Assignment selects the partitions and offset ranges to read. All partitions are read if it's nil
+	Assignment *Assignment
+	// Workers is the number of partitions read and messages matched in parallel. 0 is one worker
+	Workers int
+	// MaxMatches stops the search once a number of messages have been matched. 0 is no limit
+	MaxMatches int64
+	// SpillThreshold is the number of matched messages kept in memory before the remaining are
+	// spilled to a temporary file. 0 is never
+	SpillThreshold int64
+	// IdleTimeout stops reading once nothing has been read for a duration, in case the end of a
+	// partition is never reported. 0 is no timeout
+	IdleTimeout time.Duration
+	// Handler is called with each matched message instead of collecting it in the result, unless it's nil
+	Handler MessageHandler
+	// Progress receives the progress of the search, unless it's nil
+	Progress Progress
+}
+
+// Searcher searches the messages already published on Kafka topics
+type Searcher struct {
+	connection Connection
+	options    SearchOptions
+}
+
+// NewSearcher creates a searcher, or returns an error if the options are invalid
+func NewSearcher(connection Connection, options SearchOptions) (*Searcher, error) {
+	if len(options.Topics) == 0 && options.TopicPattern == "" {
+		return nil, ErrNoTopics
+	} else if !options.From.IsZero() && options.Latest {
+		return nil, ErrConflictingStart
+	} else if options.Assignment != nil && options.Assignment.HasRanges() && (!options.From.IsZero() || options.Latest) {
+		return nil, ErrConflictingStart
+	} else if !options.To.IsZero() && options.Latest {
+		return nil, errors.New("an end time can't be combined with latest")
+	} else if !options.From.IsZero() && !options.To.IsZero() && !options.To.After(options.From) {
+		return nil, ErrInvalidTimeWindow
+	} else if options.Limit < 0 {
+		return nil, errors.New("limit cannot be less than zero")
+	} else if options.Workers < 0 {
+		return nil, errors.New("workers cannot be less than zero")
+	} else if options.MaxMatches < 0 {
+		return nil, errors.New("max matches cannot be less than zero")
+	} else if options.SpillThreshold < 0 {
+		return nil, errors.New("spill threshold cannot be less than zero")
+	} else if options.IdleTimeout < 0 {
+		return nil, errors.New("idle timeout cannot be less than zero")
+	}
+
+	if options.Workers == 0 {
+		options.Workers = 1
+	}
+
+	return &Searcher{connection: connection, options: options}, nil
+}
+
+// Search reads the topics and matches their messages. The search stops early once the context is cancelled,
+// in which case the result contains the messages read before the cancellation. The result is also returned
+// together with an error if reading fails
+func (searcher *Searcher) Search(ctx context.Context) (Result, error) {
+	options := searcher.options
+	reporter := reporter{progress: options.Progress}
+
+	reporter.started(StageConnecting)
+	consumer, err := kafka.CreateEarliestConsumer(searcher.connection, options.Group)
+	if err != nil {
+		reporter.done(StageConnecting)
+		return Result{}, fmt.Errorf("unable to create consumer: %w", err)
+	}
+
+	topics, err := kafka.ResolveTopics(consumer, options.Topics, options.TopicPattern)
+	reporter.done(StageConnecting)
+	if err != nil {
+		_ = consumer.Close()
+		return Result{}, fmt.Errorf("unable to resolve topics: %w", err)
+	}
+
+	reporter.started(StageReadingMetadata)
+	partitions, err := kafka.GetPartitions(consumer, topics)
+	if err == nil && options.Assignment != nil {
+		partitions, err = options.Assignment.Select(partitions)
+	}
+	reporter.updated(StageReadingMetadata, int64(len(partitions)), int64(len(partitions)), 0)
+	reporter.done(StageReadingMetadata)
+	if err != nil {
+		_ = consumer.Close()
+		return Result{}, fmt.Errorf("unable to read partitions: %w", err)
+	}
+
+	// Create a consumer for each worker, up to one consumer per partition
+	consumers := []kafka.Consumer{consumer}
+	if options.Workers > 1 && len(partitions) > 1 {
+		count := options.Workers
+		if count > len(partitions) {
+			count = len(partitions)
+		}
+
+		reporter.started(StageConnectingWorkers)
+		additionalConsumers, err := kafka.CreateEarliestConsumers(searcher.connection, options.Group, count - 1)
+		reporter.updated(StageConnectingWorkers, int64(len(additionalConsumers)), int64(count - 1), 0)
+		reporter.done(StageConnectingWorkers)
+		if err != nil {
+			_ = consumer.Close()
+			return Result{}, fmt.Errorf("unable to create consumer: %w", err)
+		}
+		consumers = append(consumers, additionalConsumers...)
+	}
+
+	reporter.started(StageReading)
+	result, err := kafka.Consume(ctx, consumers, partitions, kafka.ConsumeOptions{
+		Query:          options.Query,
+		Decoders:       options.Decoders,
+		Limit:          options.Limit,
+		From:           options.From,
+		To:             options.To,
+		Latest:         options.Latest,
+		Workers:        options.Workers,
+		MaxMatches:     options.MaxMatches,
+		SpillThreshold: options.SpillThreshold,
+		IdleTimeout:    options.IdleTimeout,
+		Handler:        options.Handler,
+		Progress:       reporter.progressFunc(StageReading),
+	})
+	reporter.done(StageReading)
+
+	reporter.started(StageDisconnecting)
+	stopErr := kafka.StopConsumers(consumers)
+	reporter.done(StageDisconnecting)
+
+	if err != nil {
+		return result, fmt.Errorf("unable to read messages: %w", err)
+	} else if stopErr != nil {
+		return result, fmt.Errorf("unable to stop consumer: %w", stopErr)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,178 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package raccoon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/karldahlgren/raccoon/kafka"
+	"time"
+)
+
+// TailOptions configures a tail
+type TailOptions struct {
+	// Topics to tail
+	Topics []string
+	// TopicPattern is a regular expression matching the names of additional topics to tail
+	TopicPattern string
+	// Group is the consumer group name. A random group name is used if it's empty
+	Group string
+	// Query selects the messages to match. Every message is matched if it's nil
+	Query *Query
+	// Decoders decode the keys and values of the messages before they are matched
+	Decoders Decoders
+	// Limit stops the tail once a number of new messages have been read. 0 is no limit
+	Limit int64
+	// From catches up from a time before following new messages, unless it's zero
+	From time.Time
+	// Earliest catches up from the earliest offset before following new messages
+	Earliest bool
+	// LatestMinus catches up from the latest offset minus a number of messages per partition
+	// before following new messages, unless it's zero
+	LatestMinus int64
+	// SpillThreshold is the number of matched messages kept in memory before the remaining are
+	// spilled to a temporary file. 0 is never
+	SpillThreshold int64
+	// IdleTimeout stops catching up once nothing has been read for a duration, in case the end of a
+	// partition is never reported. 0 is no timeout
+	IdleTimeout time.Duration
+	// Handler is called with each matched message instead of collecting it in the result, unless it's nil
+	Handler MessageHandler
+	// Progress receives the progress of the tail, unless it's nil
+	Progress Progress
+}
+
+// Tailer follows the messages published on Kafka topics
+type Tailer struct {
+	connection Connection
+	options    TailOptions
+}
+
+// NewTailer creates a tailer, or returns an error if the options are invalid
+func NewTailer(connection Connection, options TailOptions) (*Tailer, error) {
+	starts := 0
+	for _, set := range []bool{!options.From.IsZero(), options.Earliest, options.LatestMinus != 0} {
+		if set {
+			starts++
+		}
+	}
+
+	if len(options.Topics) == 0 && options.TopicPattern == "" {
+		return nil, ErrNoTopics
+	} else if starts > 1 {
+		return nil, ErrConflictingStart
+	} else if options.Limit < 0 {
+		return nil, errors.New("limit cannot be less than zero")
+	} else if options.LatestMinus < 0 {
+		return nil, errors.New("latest minus cannot be less than zero")
+	} else if options.SpillThreshold < 0 {
+		return nil, errors.New("spill threshold cannot be less than zero")
+	} else if options.IdleTimeout < 0 {
+		return nil, errors.New("idle timeout cannot be less than zero")
+	}
+
+	return &Tailer{connection: connection, options: options}, nil
+}
+
+// Tail catches up from the start position, if one has been provided, and then follows new messages until the
+// context is cancelled or until the limit has been reached. The result contains the messages matched while
+// catching up followed by the messages matched while following, and is also returned together with an error
+func (tailer *Tailer) Tail(ctx context.Context) (Result, error) {
+	options := tailer.options
+	reporter := reporter{progress: options.Progress}
+	catchUp := !options.From.IsZero() || options.Earliest || options.LatestMinus > 0
+
+	reporter.started(StageConnecting)
+	consumer, err := kafka.CreateLatestConsumer(tailer.connection, options.Group)
+	if err != nil {
+		reporter.done(StageConnecting)
+		return Result{}, fmt.Errorf("unable to create consumer: %w", err)
+	}
+
+	topics, err := kafka.ResolveTopics(consumer, options.Topics, options.TopicPattern)
+	if err == nil && !catchUp {
+		err = kafka.Subscribe(consumer, topics)
+	}
+	reporter.done(StageConnecting)
+	if err != nil {
+		_ = consumer.Close()
+		return Result{}, fmt.Errorf("unable to subscribe to topics: %w", err)
+	}
+
+	var catchUpResult Result
+	if catchUp {
+		reporter.started(StageReadingMetadata)
+		partitions, err := kafka.GetPartitions(consumer, topics)
+		reporter.updated(StageReadingMetadata, int64(len(partitions)), int64(len(partitions)), 0)
+		reporter.done(StageReadingMetadata)
+		if err != nil {
+			_ = consumer.Close()
+			return Result{}, fmt.Errorf("unable to read partitions: %w", err)
+		}
+
+		// Read the messages published before the start of the tail
+		reporter.started(StageCatchingUp)
+		catchUpResult, err = kafka.CatchUp(ctx, consumer, partitions, kafka.CatchUpOptions{
+			Query:          options.Query,
+			Decoders:       options.Decoders,
+			From:           options.From,
+			Earliest:       options.Earliest,
+			LatestMinus:    options.LatestMinus,
+			SpillThreshold: options.SpillThreshold,
+			IdleTimeout:    options.IdleTimeout,
+			Handler:        options.Handler,
+			Progress:       reporter.progressFunc(StageCatchingUp),
+		})
+		reporter.done(StageCatchingUp)
+		if err != nil {
+			_ = kafka.StopConsumer(consumer)
+			return catchUpResult, fmt.Errorf("unable to catch up: %w", err)
+		}
+	}
+
+	limit := options.Limit
+	if limit == 0 {
+		limit = -1
+	}
+
+	reporter.started(StageReading)
+	result, err := kafka.Tail(ctx, consumer, options.Query, options.Decoders, limit, options.SpillThreshold,
+		options.Handler, reporter.progressFunc(StageReading))
+	result = kafka.MergeResults(catchUpResult, result)
+	reporter.done(StageReading)
+
+	reporter.started(StageDisconnecting)
+	stopErr := kafka.StopConsumer(consumer)
+	reporter.done(StageDisconnecting)
+
+	if err != nil {
+		return result, fmt.Errorf("unable to read messages: %w", err)
+	} else if stopErr != nil {
+		return result, fmt.Errorf("unable to stop consumer: %w", stopErr)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,169 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts of times with an explicit UTC offset
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04Z07:00",
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02T15:04-0700",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04 -0700",
+}
+
+// Layouts of times without a timezone, which are only accepted together with a timezone name
+var localTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var relativeTimePattern = regexp.MustCompile(`^[+-]([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d|w))+$`)
+var durationPartPattern = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+var epochPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// ParseTime parses a time in one of the following formats:
+//   - RFC3339, or a similar format with an explicit UTC offset, e.g. 2021-01-01T14:00:00+01:00
+//   - A local time followed by a timezone name, e.g. 2021-01-01 14:00 Europe/Stockholm
+//   - A duration relative to now, e.g. -15m, -2h or -1d
+//   - Epoch milliseconds, e.g. 1609509600000
+//   - The keywords now, today and yesterday, where today and yesterday are midnight in the local timezone
+func ParseTime(text string, now time.Time) (time.Time, error) {
+	text = strings.TrimSpace(text)
+
+	switch strings.ToLower(text) {
+	case "":
+		return time.Time{}, fmt.Errorf("empty time")
+	case "now":
+		return now, nil
+	case "today":
+		return midnight(now), nil
+	case "yesterday":
+		return midnight(now).AddDate(0, 0, -1), nil
+	}
+
+	if relativeTimePattern.MatchString(text) {
+		return parseRelativeTime(text, now)
+	}
+
+	if epochPattern.MatchString(text) {
+		milliseconds, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid epoch milliseconds %q", text)
+		}
+		return time.Unix(0, milliseconds * int64(time.Millisecond)), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if timestamp, err := time.Parse(layout, text); err == nil {
+			return timestamp, nil
+		}
+	}
+
+	for _, layout := range localTimeLayouts {
+		if _, err := time.Parse(layout, text); err == nil {
+			return time.Time{}, fmt.Errorf("time %q is missing a timezone. Add a timezone name, e.g. %s Europe/Stockholm, " +
+				"or use an RFC3339 time with a UTC offset", text, text)
+		}
+	}
+
+	if separator := strings.LastIndex(text, " "); separator != -1 {
+		if timestamp, ok, err := parseTimeInLocation(text[:separator], text[separator+1:]); ok {
+			return timestamp, err
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q. Expected an RFC3339 time, e.g. 2021-01-01T14:00:00Z, " +
+		"a local time with a timezone name, e.g. 2021-01-01 14:00 Europe/Stockholm, a relative duration, e.g. -15m or -1d, " +
+		"epoch milliseconds, or one of now, today and yesterday", text)
+}
+
+// parseTimeInLocation parses a local time in a named timezone. False is returned if the text isn't a local time
+func parseTimeInLocation(text string, name string) (time.Time, bool, error) {
+	for _, layout := range localTimeLayouts {
+		if _, err := time.Parse(layout, text); err != nil {
+			continue
+		}
+
+		location, err := time.LoadLocation(name)
+		if err != nil || name == "" || name == "Local" {
+			return time.Time{}, true, fmt.Errorf("unknown timezone %q. Expected a timezone name, e.g. Europe/Stockholm", name)
+		}
+
+		timestamp, err := time.ParseInLocation(layout, text, location)
+		return timestamp, true, err
+	}
+
+	return time.Time{}, false, nil
+}
+
+func parseRelativeTime(text string, now time.Time) (time.Time, error) {
+	var duration time.Duration
+	for _, part := range durationPartPattern.FindAllStringSubmatch(text[1:], -1) {
+		value, unit := part[1], part[2]
+
+		switch unit {
+		case "d", "w":
+			days, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid relative time %q", text)
+			}
+			if unit == "w" {
+				days *= 7
+			}
+			duration += time.Duration(days * float64(24 * time.Hour))
+		default:
+			partDuration, err := time.ParseDuration(value + unit)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid relative time %q", text)
+			}
+			duration += partDuration
+		}
+	}
+
+	if strings.HasPrefix(text, "-") {
+		duration = -duration
+	}
+
+	return now.Add(duration), nil
+}
+
+func midnight(now time.Time) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+}
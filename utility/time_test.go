@@ -0,0 +1,104 @@
+/*
+ * The MIT License
+ *
+ * Copyright (c) 2020-, Karl A. Dahlgren
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE.
+ */
+package utility
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// now is the fixed clock of the tests
+var now = time.Date(2021, 3, 10, 9, 30, 0, 0, time.UTC)
+
+func TestParseTime(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		t.Fatalf("unable to load timezone: %v", err)
+	}
+
+	tests := []struct {
+		text     string
+		now      time.Time
+		expected time.Time
+	}{
+		{text: "now", now: now, expected: now},
+		{text: "-15m", now: now, expected: now.Add(-15 * time.Minute)},
+		{text: "-1d12h", now: now, expected: now.Add(-36 * time.Hour)},
+		{text: "-2w", now: now, expected: now.AddDate(0, 0, -14)},
+		{text: "-1.5h", now: now, expected: now.Add(-90 * time.Minute)},
+		{text: "+30s", now: now, expected: now.Add(30 * time.Second)},
+		{text: "1609509600000", now: now, expected: time.Date(2021, 1, 1, 14, 0, 0, 0, time.UTC)},
+		{text: "1609509600123", now: now, expected: time.Date(2021, 1, 1, 14, 0, 0, 123000000, time.UTC)},
+		{text: "2021-01-01T14:00:00Z", now: now, expected: time.Date(2021, 1, 1, 14, 0, 0, 0, time.UTC)},
+		{text: "2021-01-01T14:00:00+01:00", now: now, expected: time.Date(2021, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{text: "2021-01-01 14:00 -0500", now: now, expected: time.Date(2021, 1, 1, 19, 0, 0, 0, time.UTC)},
+		{text: "2021-01-01 14:00 Europe/Stockholm", now: now, expected: time.Date(2021, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{text: "2021-07-01 14:00 Europe/Stockholm", now: now, expected: time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)},
+		{text: "2021-01-01 Asia/Tokyo", now: now, expected: time.Date(2020, 12, 31, 15, 0, 0, 0, time.UTC)},
+		{text: "today", now: now, expected: time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{text: "Yesterday", now: now, expected: time.Date(2021, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{text: "today", now: time.Date(2021, 3, 10, 0, 30, 0, 0, stockholm),
+			expected: time.Date(2021, 3, 10, 0, 0, 0, 0, stockholm)},
+		{text: "yesterday", now: time.Date(2021, 3, 28, 12, 0, 0, 0, stockholm),
+			expected: time.Date(2021, 3, 27, 0, 0, 0, 0, stockholm)},
+	}
+
+	for _, test := range tests {
+		parsed, err := ParseTime(test.text, test.now)
+		if err != nil {
+			t.Errorf("unable to parse %q: %v", test.text, err)
+		} else if !parsed.Equal(test.expected) {
+			t.Errorf("expected %q to be parsed as %v, got %v", test.text, test.expected, parsed)
+		}
+	}
+}
+
+func TestParseTimeRejectsInvalidTimes(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "", expected: "empty time"},
+		{text: "2021-01-01 14:00", expected: "is missing a timezone"},
+		{text: "2021-01-01T14:00:00", expected: "is missing a timezone"},
+		{text: "2021-01-01 14:00 Mars/Olympus", expected: `unknown timezone "Mars/Olympus"`},
+		{text: "2021-01-01 14:00 Local", expected: `unknown timezone "Local"`},
+		{text: "-1y", expected: "invalid time"},
+		{text: "15m", expected: "invalid time"},
+		{text: "tomorrow", expected: "invalid time"},
+		{text: "14:00 Europe/Stockholm", expected: "invalid time"},
+		{text: "2021-13-01T14:00:00Z", expected: "invalid time"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseTime(test.text, now)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", test.text)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("expected %q to be rejected with %q, got %q", test.text, test.expected, err)
+		}
+	}
+}
@@ -36,13 +36,3 @@ func ExitOnError(err error) {
 		os.Exit(1)
 	}
 }
-
-// Sum calculates the sum of all values in a map
-func Sum(values map[int32]int64) int64  {
-	total := int64(0)
-	for _, value := range values {
-		total += value
-	}
-
-	return total
-}